@@ -0,0 +1,48 @@
+package zhttp
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// NewACME creates a new ACME manager to get certificates from Let's Encrypt.
+//
+// Certificates are stored in cacheDir, and only requested for the given hosts;
+// use [HostRouteHosts] to get the hosts from the routers for [HostRoute].
+//
+// Set it as Server.ACME to use it; the HTTP-01 challenges are answered on the
+// redirect server, so Server.Redirect should be set. The Client can be set to
+// use a different ACME server:
+//
+//	m := zhttp.NewACME("/var/cache/acme", "admin@example.com", zhttp.HostRouteHosts(routers)...)
+//	m.Client = &acme.Client{DirectoryURL: "https://localhost:14000/dir"}
+func NewACME(cacheDir, email string, hosts ...string) *autocert.Manager {
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		Cache:      autocert.DirCache(cacheDir),
+		HostPolicy: autocert.HostWhitelist(hosts...),
+		Email:      email,
+		Client:     &acme.Client{DirectoryURL: autocert.DefaultACMEDirectory},
+	}
+}
+
+// HostRouteHosts gets all hosts from the routers passed to [HostRoute], for
+// use with [NewACME].
+//
+// Wildcards are skipped, as certificates for them can't be requested with the
+// HTTP-01 challenge.
+func HostRouteHosts(routers map[string]http.Handler) []string {
+	hosts := make([]string, 0, len(routers))
+	for k := range routers {
+		if strings.Contains(k, "*") {
+			continue
+		}
+		hosts = append(hosts, k)
+	}
+	slices.Sort(hosts)
+	return hosts
+}
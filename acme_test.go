@@ -0,0 +1,125 @@
+package zhttp
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"reflect"
+	"testing"
+
+	"golang.org/x/crypto/acme"
+)
+
+func TestHostRouteHosts(t *testing.T) {
+	have := HostRouteHosts(map[string]http.Handler{
+		"example.com":     nil,
+		"www.example.com": nil,
+		"*.example.com":   nil,
+		"api.*":           nil,
+		"*":               nil,
+	})
+	want := []string{"example.com", "www.example.com"}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("\nhave: %q\nwant: %q", have, want)
+	}
+}
+
+// Test against pebble (https://github.com/letsencrypt/pebble); this is skipped
+// unless ZHTTP_PEBBLE is set to the directory URL. ZHTTP_PEBBLE_CA should point
+// to the root certificate of pebble's API (test/certs/pebble.minica.pem).
+//
+// Pebble validates HTTP-01 challenges on port 5002 by default. autocert
+// requires at least one dot in the hostname, so this uses "zhttp.test", which
+// should resolve to 127.0.0.1 (e.g. add it to /etc/hosts); set
+// ZHTTP_PEBBLE_HOST to use a different name.
+//
+// Newer versions of pebble don't work with autocert; v2.7.0 is known to work.
+//
+//	pebble -config test/config/pebble-config.json &
+//	ZHTTP_PEBBLE=https://localhost:14000/dir ZHTTP_PEBBLE_CA=test/certs/pebble.minica.pem go test -run ACME
+func TestACME(t *testing.T) {
+	dir := os.Getenv("ZHTTP_PEBBLE")
+	if dir == "" {
+		t.Skip("ZHTTP_PEBBLE not set")
+	}
+	host := os.Getenv("ZHTTP_PEBBLE_HOST")
+	if host == "" {
+		host = "zhttp.test"
+	}
+
+	pool := x509.NewCertPool()
+	ca, err := os.ReadFile(os.Getenv("ZHTTP_PEBBLE_CA"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.AppendCertsFromPEM(ca)
+
+	m := NewACME(t.TempDir(), "", host)
+	m.Client = &acme.Client{
+		DirectoryURL: dir,
+		HTTPClient:   &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}},
+	}
+
+	s := Server{
+		Server:       &http.Server{Addr: "127.0.0.1:0"},
+		Redirect:     true,
+		RedirectPort: "5002",
+		ACME:         m,
+		Logger:       slog.New(slog.DiscardHandler),
+	}
+	startServer(t, &s)
+
+	// Get the certificate directly first, so we can see the error.
+	_, err = m.GetCertificate(&tls.ClientHelloInfo{ServerName: host})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := tls.Dial("tcp", s.Server.Addr, &tls.Config{ServerName: host, InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	cert := conn.ConnectionState().PeerCertificates[0]
+	if len(cert.DNSNames) != 1 || cert.DNSNames[0] != host {
+		t.Errorf("wrong names: %v", cert.DNSNames)
+	}
+}
+
+func TestACMEChallenge(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, rport, _ := net.SplitHostPort(ln.Addr().String())
+	ln.Close()
+
+	s := Server{
+		Server:       &http.Server{Addr: "127.0.0.1:0"},
+		Redirect:     true,
+		RedirectPort: rport,
+		ACME:         NewACME(t.TempDir(), "", "localhost"),
+		Logger:       slog.New(slog.DiscardHandler),
+	}
+	startServer(t, &s)
+
+	if s.Server.TLSConfig == nil || s.Server.TLSConfig.GetCertificate == nil {
+		t.Error("TLSConfig not set")
+	}
+
+	// Unknown token: handled by autocert rather than redirected.
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get("http://localhost:" + rport + "/.well-known/acme-challenge/xxx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 404 {
+		t.Errorf("wrong status: %d", resp.StatusCode)
+	}
+}
@@ -107,13 +107,13 @@ func Add(load loadFunc, noCSRF ...string) func(http.Handler) http.Handler {
 					r.Form.Del("csrf")
 					if token == "" {
 						w.WriteHeader(http.StatusForbidden)
-						fmt.Fprintln(w, "CSRF token is empty") // TODO: should probably use errpage?
+						fmt.Fprintln(w, zhttp.T(r.Context(), "CSRF token is empty")) // TODO: should probably use errpage?
 						return
 					} else {
 						t := u.CSRFToken()
 						if t != "" && token != t {
 							w.WriteHeader(http.StatusForbidden)
-							fmt.Fprintln(w, "Invalid CSRF token") // TODO: should probably use errpage?
+							fmt.Fprintln(w, zhttp.T(r.Context(), "Invalid CSRF token")) // TODO: should probably use errpage?
 							return
 						}
 					}
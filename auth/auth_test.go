@@ -71,3 +71,29 @@ func TestCSRF(t *testing.T) {
 		}
 	}
 }
+
+type testTranslator struct{}
+
+func (testTranslator) Languages() []string { return []string{"en", "nl"} }
+func (testTranslator) Translate(lang, msg string, args ...any) string {
+	if lang == "nl" && msg == "CSRF token is empty" {
+		return "CSRF-token is leeg"
+	}
+	return msg
+}
+
+func TestCSRFTranslate(t *testing.T) {
+	handler := zhttp.WithTranslator(testTranslator{})(Add(func(ctx context.Context, email string) (User, error) {
+		return testUser{}, nil
+	})(handle{}))
+
+	r, _ := http.NewRequest("POST", "", strings.NewReader(""))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("Accept-Language", "nl")
+	r.AddCookie(&http.Cookie{Name: zhttp.CookieAuthName, Value: "x"})
+
+	rr := ztest.HTTP(t, r, handler)
+	if rr.Code != http.StatusForbidden || rr.Body.String() != "CSRF-token is leeg\n" {
+		t.Fatalf("%d: %#v", rr.Code, rr.Body.String())
+	}
+}
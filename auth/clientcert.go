@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"context"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+
+	"zgo.at/guru"
+	"zgo.at/zhttp/ctxkey"
+)
+
+// ClientIdentity is the identity from a verified TLS client certificate.
+type ClientIdentity struct {
+	Cert        *x509.Certificate // Client certificate.
+	CommonName  string            // Subject CN.
+	DNSNames    []string          // SAN DNS names.
+	Emails      []string          // SAN email addresses.
+	URIs        []*url.URL        // SAN URIs, e.g. SPIFFE IDs.
+	IPAddresses []net.IP          // SAN IP addresses.
+}
+
+// Names gets all names for this identity: the CN followed by the DNS, email,
+// URI, and IP SANs.
+func (id ClientIdentity) Names() []string {
+	names := make([]string, 0, 1+len(id.DNSNames)+len(id.Emails)+len(id.URIs)+len(id.IPAddresses))
+	if id.CommonName != "" {
+		names = append(names, id.CommonName)
+	}
+	names = append(names, id.DNSNames...)
+	names = append(names, id.Emails...)
+	for _, u := range id.URIs {
+		names = append(names, u.String())
+	}
+	for _, ip := range id.IPAddresses {
+		names = append(names, ip.String())
+	}
+	return names
+}
+
+// ClientCert adds the identity from the client certificate to the context, if
+// there is one. Only certificates that were verified against the client CAs are
+// used; see zhttp.Server.ClientCAs.
+//
+// Use [GetClientIdentity] to get it, or [AllowClientCert] to filter on it.
+func ClientCert() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			c := r.TLS.VerifiedChains[0][0]
+			id := &ClientIdentity{
+				Cert:        c,
+				CommonName:  c.Subject.CommonName,
+				DNSNames:    c.DNSNames,
+				Emails:      c.EmailAddresses,
+				URIs:        c.URIs,
+				IPAddresses: c.IPAddresses,
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxkey.ClientCert, id)))
+		})
+	}
+}
+
+// GetClientIdentity gets the client certificate identity added by
+// [ClientCert], or nil if there is none.
+func GetClientIdentity(ctx context.Context) *ClientIdentity {
+	id, _ := ctx.Value(ctxkey.ClientCert).(*ClientIdentity)
+	return id
+}
+
+// AllowClientCert allows access only if the client certificate has one of the
+// names as the CN or in the SANs, for use with [Filter]:
+//
+//	h = auth.Filter(auth.AllowClientCert("backup.internal"))(h)
+//	h = auth.ClientCert()(h)
+//
+// Any verified certificate is allowed if names is empty.
+func AllowClientCert(names ...string) filterFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		id := GetClientIdentity(r.Context())
+		if id == nil {
+			return guru.New(http.StatusUnauthorized, "client certificate required")
+		}
+		if len(names) == 0 {
+			return nil
+		}
+		for _, n := range id.Names() {
+			if slices.Contains(names, n) {
+				return nil
+			}
+		}
+		return guru.New(http.StatusForbidden, "client certificate not allowed")
+	}
+}
@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"zgo.at/zstd/ztest"
+)
+
+func TestClientCert(t *testing.T) {
+	cert := &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "backup"},
+		DNSNames:       []string{"backup.internal"},
+		EmailAddresses: []string{"backup@example.com"},
+		URIs:           []*url.URL{{Scheme: "spiffe", Host: "example.com", Path: "/backup"}},
+	}
+
+	tests := []struct {
+		name     string
+		tls      *tls.ConnectionState
+		allow    []string
+		wantCode int
+		wantBody string
+	}{
+		{"no tls", nil, nil, 401, ""},
+		{"not verified", &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}, nil, 401, ""},
+		{"any", &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}, nil,
+			200, "backup backup.internal backup@example.com spiffe://example.com/backup"},
+		{"cn", &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}, []string{"backup"}, 200, "backup"},
+		{"uri", &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}, []string{"spiffe://example.com/backup"}, 200, "backup"},
+		{"not allowed", &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}, []string{"other"}, 403, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var h http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				id := GetClientIdentity(r.Context())
+				for i, n := range id.Names() {
+					if i > 0 {
+						fmt.Fprint(w, " ")
+					}
+					fmt.Fprint(w, n)
+				}
+			})
+			h = Filter(AllowClientCert(tt.allow...))(h)
+			h = ClientCert()(h)
+
+			r, _ := http.NewRequest("GET", "/", nil)
+			r.TLS = tt.tls
+			rr := ztest.HTTP(t, r, h)
+			ztest.Code(t, rr, tt.wantCode)
+			if tt.wantCode == 200 && !strings.HasPrefix(rr.Body.String(), tt.wantBody) {
+				t.Errorf("\nhave: %q\nwant: %q", rr.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package zhttp
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CertLoader loads TLS certificates from disk, and can reload them without
+// restarting the server. This is useful if certificates are renewed by an
+// external ACME client.
+//
+// Use GetCertificate in the tls.Config:
+//
+//	certs := zhttp.NewCertLoader()
+//	err := certs.Add("example.com.pem", "example.com.key")
+//	err = certs.Add("example.org.pem", "example.org.key")
+//
+//	s := zhttp.Server{
+//	    Server: &http.Server{
+//	        Addr:      ":443",
+//	        TLSConfig: &tls.Config{GetCertificate: certs.GetCertificate},
+//	    },
+//	    Reload: []func() error{certs.Reload},
+//	}
+//
+// The certificate is selected by SNI, using the DNS names in the certificate
+// (which may be wildcards such as "*.example.com"). The first certificate is
+// used if nothing matches.
+type CertLoader struct {
+	mu    sync.Mutex // Protects files and mtime.
+	files [][2]string
+	mtime map[string]time.Time
+	certs atomic.Pointer[[]tls.Certificate]
+}
+
+// NewCertLoader creates a new certificate loader.
+func NewCertLoader() *CertLoader {
+	c := &CertLoader{mtime: make(map[string]time.Time)}
+	c.certs.Store(&[]tls.Certificate{})
+	return c
+}
+
+// Add a certificate and key, loading it immediately.
+func (c *CertLoader) Add(certFile, keyFile string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Get the mtime before loading, so that a change between loading and
+	// stat-ing is picked up by Watch.
+	mtime := statFiles(certFile, keyFile)
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return fmt.Errorf("zhttp.CertLoader.Add: %w", err)
+	}
+
+	c.files = append(c.files, [2]string{certFile, keyFile})
+	maps.Copy(c.mtime, mtime)
+	certs := append(append([]tls.Certificate{}, *c.certs.Load()...), cert)
+	c.certs.Store(&certs)
+	return nil
+}
+
+// Reload all certificates from disk.
+//
+// The certificates are swapped only if all of them load without errors; the
+// previous certificates are kept on errors.
+func (c *CertLoader) Reload() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	mtime := make(map[string]time.Time)
+	for _, f := range c.files {
+		maps.Copy(mtime, statFiles(f[0], f[1]))
+	}
+	certs := make([]tls.Certificate, 0, len(c.files))
+	for _, f := range c.files {
+		cert, err := tls.LoadX509KeyPair(f[0], f[1])
+		if err != nil {
+			return fmt.Errorf("zhttp.CertLoader.Reload: %w", err)
+		}
+		certs = append(certs, cert)
+	}
+	c.mtime = mtime
+	c.certs.Store(&certs)
+	return nil
+}
+
+// Watch the files for changes, and reload the certificates if any of them
+// changed. Errors are logged.
+//
+// This polls the modification time every interval until the context is
+// cancelled.
+func (c *CertLoader) Watch(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if !c.changed() {
+				continue
+			}
+			err := c.Reload()
+			if err != nil {
+				slog.Error(err.Error())
+			}
+		}
+	}
+}
+
+// GetCertificate returns the certificate for the ClientHello; this can be
+// used as tls.Config.GetCertificate.
+func (c *CertLoader) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	certs := *c.certs.Load()
+	if len(certs) == 0 {
+		return nil, errors.New("zhttp.CertLoader: no certificates")
+	}
+	for i := range certs {
+		if hello.SupportsCertificate(&certs[i]) == nil {
+			return &certs[i], nil
+		}
+	}
+	return &certs[0], nil
+}
+
+func (c *CertLoader) changed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, f := range c.files {
+		for _, ff := range f {
+			st, err := os.Stat(ff)
+			if err == nil && !st.ModTime().Equal(c.mtime[ff]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func statFiles(files ...string) map[string]time.Time {
+	mtime := make(map[string]time.Time, len(files))
+	for _, f := range files {
+		if st, err := os.Stat(f); err == nil {
+			mtime[f] = st.ModTime()
+		}
+	}
+	return mtime
+}
+
+// LoadCertPool loads PEM-encoded CA certificates from the files, for use as
+// Server.ClientCAs.
+func LoadCertPool(files ...string) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	for _, f := range files {
+		pem, err := os.ReadFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("zhttp.LoadCertPool: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("zhttp.LoadCertPool: no certificates in %q", f)
+		}
+	}
+	return pool, nil
+}
@@ -0,0 +1,172 @@
+package zhttp
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// genCert writes a new certificate and key to dir, returning the paths. The
+// certificate is signed by parent, or self-signed if parent is nil.
+func genCert(t *testing.T, dir, name string, parent *tls.Certificate, tmpl x509.Certificate) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl.SerialNumber = serial
+	if tmpl.Subject.CommonName == "" {
+		tmpl.Subject = pkix.Name{CommonName: name}
+	}
+	tmpl.NotBefore, tmpl.NotAfter = time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+
+	var (
+		signer    any = key
+		parentTpl     = &tmpl
+	)
+	if parent != nil {
+		signer, parentTpl = parent.PrivateKey, parent.Leaf
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &tmpl, parentTpl, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile, keyFile := filepath.Join(dir, name+".pem"), filepath.Join(dir, name+".key")
+	err = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestCertLoader(t *testing.T) {
+	dir := t.TempDir()
+	comCert, comKey := genCert(t, dir, "example.com", nil, x509.Certificate{DNSNames: []string{"example.com"}})
+	orgCert, orgKey := genCert(t, dir, "example.org", nil, x509.Certificate{DNSNames: []string{"example.org", "*.example.org"}})
+
+	certs := NewCertLoader()
+	if _, err := certs.GetCertificate(&tls.ClientHelloInfo{}); err == nil {
+		t.Error("no error with no certificates")
+	}
+	if err := certs.Add(comCert, comKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := certs.Add(orgCert, orgKey); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(name string) *x509.Certificate {
+		t.Helper()
+		c, err := certs.GetCertificate(&tls.ClientHelloInfo{
+			ServerName:        name,
+			SignatureSchemes:  []tls.SignatureScheme{tls.ECDSAWithP256AndSHA256},
+			SupportedVersions: []uint16{tls.VersionTLS13},
+			CipherSuites:      []uint16{tls.TLS_AES_128_GCM_SHA256},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c.Leaf
+	}
+
+	tests := []struct {
+		name, want string
+	}{
+		{"example.com", "example.com"},
+		{"example.org", "example.org"},
+		{"www.example.org", "example.org"},
+		{"example.net", "example.com"}, // Fallback to first.
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if have := get(tt.name).Subject.CommonName; have != tt.want {
+				t.Errorf("\nhave: %q\nwant: %q", have, tt.want)
+			}
+		})
+	}
+
+	// Replace the certificate.
+	old := get("example.com").SerialNumber
+	genCert(t, dir, "example.com", nil, x509.Certificate{DNSNames: []string{"example.com"}})
+	if err := certs.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if get("example.com").SerialNumber.Cmp(old) == 0 {
+		t.Error("not reloaded")
+	}
+
+	// Keep the old certificates on errors.
+	old = get("example.com").SerialNumber
+	os.WriteFile(comCert, []byte("broken"), 0o600)
+	if err := certs.Reload(); err == nil {
+		t.Error("no error")
+	}
+	if get("example.com").SerialNumber.Cmp(old) != 0 {
+		t.Error("certificate changed")
+	}
+}
+
+func TestCertLoaderWatch(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := genCert(t, dir, "example.com", nil, x509.Certificate{DNSNames: []string{"example.com"}})
+
+	certs := NewCertLoader()
+	if err := certs.Add(certFile, keyFile); err != nil {
+		t.Fatal(err)
+	}
+	serial := func() *big.Int {
+		c, err := certs.GetCertificate(&tls.ClientHelloInfo{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c.Leaf.SerialNumber
+	}
+	old := serial()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go certs.Watch(ctx, 10*time.Millisecond)
+
+	// Make sure the mtime differs on filesystems with a coarse resolution.
+	genCert(t, dir, "example.com", nil, x509.Certificate{DNSNames: []string{"example.com"}})
+	mtime := time.Now().Add(time.Minute)
+	for _, f := range []string{certFile, keyFile} {
+		if err := os.Chtimes(f, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; ; i++ {
+		if serial().Cmp(old) != 0 {
+			break
+		}
+		if i > 200 {
+			t.Fatal("not reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,170 @@
+package zhttp
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// StatusClientClosedRequest is used for requests that were cancelled by the
+// client; this is the (non-standard) nginx status code.
+const StatusClientClosedRequest = 499
+
+// ErrorClassifier gets the HTTP status code and user-facing error for an error
+// in [UserError].
+//
+// The returned error is displayed to the user; it can be err itself. Return 0
+// if the classifier doesn't handle this error.
+type ErrorClassifier func(err error) (int, error)
+
+var (
+	errorClassifiers   []ErrorClassifier
+	builtinClassifiers = []ErrorClassifier{
+		classifyCoder,
+		classifyPostgres,
+		classifyDecode,
+		classifyNoRows,
+		classifyContext,
+	}
+)
+
+// RegisterErrorClassifier registers a classifier for [UserError].
+//
+// Classifiers are run in the order they're registered, and before the built-in
+// classifiers. The first one that returns a status code is used. The built-in
+// classifiers are, in order:
+//
+//   - Errors with a Code() int method, such as zgo.at/guru: the code, if it's
+//     in the 400–599 range. The outermost error with a Code() is used.
+//   - SQLite errors: 409 for constraint violations (e.g. UNIQUE), and 500 for
+//     everything else. This is checked along with the Code() errors, as some
+//     SQLite drivers have a Code() method with the SQLite result code.
+//   - PostgreSQL invalid byte sequence (SQLState 22021): 400.
+//   - [ErrorDecode] and [ErrorDecodeUnknown]: 400.
+//   - [sql.ErrNoRows]: 404.
+//   - [context.DeadlineExceeded]: 504.
+//   - [context.Canceled]: 499; this isn't logged, as the client is gone.
+//
+// Errors that aren't classified are 500.
+//
+// This is not safe for concurrent use, and should be called on startup.
+func RegisterErrorClassifier(c ErrorClassifier) {
+	errorClassifiers = append(errorClassifiers, c)
+}
+
+func classifyError(err error) (int, error) {
+	for _, cs := range [][]ErrorClassifier{errorClassifiers, builtinClassifiers} {
+		for _, c := range cs {
+			if code, cErr := c(err); code > 0 {
+				return code, cErr
+			}
+		}
+	}
+	return 500, err
+}
+
+func classifyCoder(err error) (code int, cErr error) {
+	walkErr(err, func(e error) bool {
+		if isSQLite(e) {
+			code, cErr = classifySQLite(e)
+			return true
+		}
+		// zgo.at/guru with an embedded status code. Other errors may have a
+		// Code() that's not a HTTP status, so only accept error statuses.
+		if c, ok := e.(interface{ Code() int }); ok && c.Code() >= 400 && c.Code() <= 599 {
+			code, cErr = c.Code(), e
+			return true
+		}
+		return false
+	})
+	return code, cErr
+}
+
+// walkErr calls f for err and every error it wraps, depth-first, until f
+// returns true.
+func walkErr(err error, f func(error) bool) bool {
+	for err != nil {
+		if f(err) {
+			return true
+		}
+		switch u := err.(type) {
+		case interface{ Unwrap() error }:
+			err = u.Unwrap()
+		case interface{ Unwrap() []error }:
+			for _, e := range u.Unwrap() {
+				if walkErr(e, f) {
+					return true
+				}
+			}
+			return false
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+func classifyPostgres(err error) (int, error) {
+	var pqErr interface {
+		SQLState() string
+		Error() string
+	}
+	if errors.As(err, &pqErr) {
+		switch pqErr.SQLState() {
+		case "22021": //  pq: invalid byte sequence for encoding "UTF8": 0xd5
+			return 400, pqErr
+		}
+	}
+	return 0, nil
+}
+
+func classifyDecode(err error) (int, error) {
+	var (
+		dErr *ErrorDecode
+		uErr *ErrorDecodeUnknown
+	)
+	if errors.As(err, &dErr) || errors.As(err, &uErr) { // Invalid parameters.
+		return 400, err
+	}
+	return 0, nil
+}
+
+func classifyNoRows(err error) (int, error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		return 404, err
+	}
+	return 0, nil
+}
+
+func classifyContext(err error) (int, error) {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout, err
+	case errors.Is(err, context.Canceled):
+		return StatusClientClosedRequest, newUserMsg("request cancelled")
+	}
+	return 0, nil
+}
+
+// There's no common error type for SQLite drivers, so look for error types with
+// "sqlite" in the name, such as sqlite3.Error from github.com/mattn/go-sqlite3
+// or *sqlite.Error from modernc.org/sqlite.
+func isSQLite(err error) bool {
+	return strings.Contains(strings.ToLower(reflect.TypeOf(err).String()), "sqlite")
+}
+
+// modernc.org/sqlite has a Code() method with the SQLite result code, so never
+// return 0 here to make sure that's not used as a HTTP status.
+func classifySQLite(err error) (int, error) {
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "UNIQUE constraint failed"), strings.Contains(msg, "PRIMARY KEY constraint failed"):
+		return http.StatusConflict, newUserMsg("already exists")
+	case strings.Contains(msg, "constraint failed"):
+		return http.StatusConflict, newUserMsg("conflicts with existing data")
+	}
+	return 500, err
+}
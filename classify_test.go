@@ -0,0 +1,67 @@
+package zhttp
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+
+	"zgo.at/guru"
+)
+
+type sqliteErr struct {
+	msg  string
+	code int
+}
+
+func (e sqliteErr) Error() string { return e.msg }
+func (e sqliteErr) Code() int     { return e.code } // Like modernc.org/sqlite
+
+type domainErr struct{}
+
+func (domainErr) Error() string { return "out of stock" }
+
+func TestUserError(t *testing.T) {
+	RegisterErrorClassifier(func(err error) (int, error) {
+		if errors.As(err, new(domainErr)) {
+			return 422, errors.New("sorry, that's out of stock")
+		}
+		return 0, nil
+	})
+	defer func() { errorClassifiers = nil }()
+
+	tests := []struct {
+		err      error
+		wantCode int
+		wantMsg  string
+	}{
+		{guru.New(403, "nope"), 403, "nope"},
+		{sql.ErrNoRows, 404, "not found"},
+		{fmt.Errorf("wrap: %w", sql.ErrNoRows), 404, "not found"},
+		{context.DeadlineExceeded, 504, "server timed out loading data"},
+		{context.Canceled, 499, "request cancelled"},
+		{&ErrorDecode{}, 400, ""},
+		{sqliteErr{"UNIQUE constraint failed: users.email", 2067}, 409, "already exists"},
+		{fmt.Errorf("insert: %w", sqliteErr{"FOREIGN KEY constraint failed", 787}), 409, "conflicts with existing data"},
+		{sqliteErr{"database is locked (5) (SQLITE_BUSY)", 5}, 500, ""},
+		{sqliteErr{"database is locked (517) (SQLITE_BUSY_SNAPSHOT)", 517}, 500, ""},
+		{guru.Wrap(400, sqliteErr{"UNIQUE constraint failed: users.email", 2067}, "email is taken"), 400, "email is taken"},
+		{fmt.Errorf("x: %w", guru.New(403, "nope")), 403, "nope"},
+		{errors.Join(errors.New("a"), guru.New(403, "nope")), 403, "nope"},
+		{fmt.Errorf("x: %w", domainErr{}), 422, "sorry, that's out of stock"},
+		{errors.New("oh noes"), 500, "unexpected error code ‘" + UserErrorCode(errors.New("oh noes")) + "’; this has been reported for investigation"},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%T", tt.err), func(t *testing.T) {
+			code, err := UserError(tt.err)
+			if code != tt.wantCode {
+				t.Errorf("wrong code\nhave: %d\nwant: %d", code, tt.wantCode)
+			}
+			if tt.wantMsg != "" && err.Error() != tt.wantMsg {
+				t.Errorf("wrong message\nhave: %s\nwant: %s", err, tt.wantMsg)
+			}
+		})
+	}
+}
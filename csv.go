@@ -0,0 +1,105 @@
+package zhttp
+
+import (
+	"encoding/csv"
+	"fmt"
+	"iter"
+	"net/http"
+	"slices"
+	"time"
+
+	"zgo.at/zhttp/header"
+)
+
+// CSVOptions are options for [CSVWith] and [CSVEncoder].
+type CSVOptions struct {
+	// Write a UTF-8 byte order mark; Excel needs this to detect the file as
+	// UTF-8.
+	BOM bool
+
+	// Field delimiter; default is ','.
+	Comma rune
+}
+
+// CSV sends the rows as CSV, as an attachment with the given filename.
+//
+// The rows are streamed to the client as they're produced, so this can be used
+// for large exports. The filename is optional.
+func CSV(w http.ResponseWriter, filename string, rows iter.Seq[[]string]) error {
+	return CSVWith(w, filename, rows, CSVOptions{})
+}
+
+// CSVWith is like [CSV], but with options.
+func CSVWith(w http.ResponseWriter, filename string, rows iter.Seq[[]string], opts CSVOptions) error {
+	if filename != "" {
+		err := header.SetContentDisposition(w.Header(), header.DispositionArgs{
+			Type:     header.TypeAttachment,
+			Filename: filename,
+		})
+		if err != nil {
+			return fmt.Errorf("zhttp.CSV: %w", err)
+		}
+	}
+	writeStatus(w, 200, "text/csv; charset=utf-8")
+	return writeCSV(w, rows, opts)
+}
+
+// CSVEncoder creates an [Encoder] for [Respond]:
+//
+//	zhttp.RegisterEncoder("text/csv", zhttp.CSVEncoder(zhttp.CSVOptions{}))
+//
+// The data can be a [][]string, an iter.Seq[[]string], or a type with a
+// CSV() iter.Seq[[]string] method.
+//
+// Use [header.SetContentDisposition] before calling Respond to send it as a
+// download.
+func CSVEncoder(opts CSVOptions) Encoder {
+	return func(w http.ResponseWriter, r *http.Request, status int, data any) error {
+		var rows iter.Seq[[]string]
+		switch d := data.(type) {
+		case [][]string:
+			rows = slices.Values(d)
+		case iter.Seq[[]string]:
+			rows = d
+		case interface{ CSV() iter.Seq[[]string] }:
+			rows = d.CSV()
+		default:
+			return fmt.Errorf("zhttp.CSVEncoder: can't encode %T as CSV", data)
+		}
+		w.WriteHeader(status)
+		return writeCSV(w, rows, opts)
+	}
+}
+
+func writeCSV(w http.ResponseWriter, rows iter.Seq[[]string], opts CSVOptions) error {
+	if opts.BOM {
+		if _, err := w.Write([]byte("\xef\xbb\xbf")); err != nil {
+			return err
+		}
+	}
+
+	var (
+		c         = csv.NewWriter(w)
+		rc        = http.NewResponseController(w)
+		lastFlush = time.Now()
+	)
+	if opts.Comma != 0 {
+		c.Comma = opts.Comma
+	}
+	for row := range rows {
+		if err := c.Write(row); err != nil {
+			return err
+		}
+		// Flush every second, so the client sees progress on slow exports.
+		if time.Since(lastFlush) >= time.Second {
+			c.Flush()
+			if err := c.Error(); err != nil {
+				return err
+			}
+			rc.Flush()
+			lastFlush = time.Now()
+		}
+	}
+	c.Flush()
+	return c.Error()
+}
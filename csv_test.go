@@ -0,0 +1,79 @@
+package zhttp
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestCSV(t *testing.T) {
+	rows := [][]string{{"id", "name"}, {"1", "x,y"}, {"2", `"q"`}}
+
+	t.Run("CSV", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		err := CSV(rr, "export.csv", slices.Values(rows))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h := rr.Header().Get("Content-Type"); h != "text/csv; charset=utf-8" {
+			t.Errorf("Content-Type: %q", h)
+		}
+		if h := rr.Header().Get("Content-Disposition"); h != `attachment; filename="export.csv"` {
+			t.Errorf("Content-Disposition: %q", h)
+		}
+		want := "id,name\n1,\"x,y\"\n2,\"\"\"q\"\"\"\n"
+		if have := rr.Body.String(); have != want {
+			t.Errorf("\nhave: %q\nwant: %q", have, want)
+		}
+	})
+
+	t.Run("BOM", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		err := CSVWith(rr, "", slices.Values(rows[:1]), CSVOptions{BOM: true, Comma: ';'})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h := rr.Header().Get("Content-Disposition"); h != "" {
+			t.Errorf("Content-Disposition: %q", h)
+		}
+		if have, want := rr.Body.String(), "\xef\xbb\xbfid;name\n"; have != want {
+			t.Errorf("\nhave: %q\nwant: %q", have, want)
+		}
+	})
+
+	t.Run("encoder", func(t *testing.T) {
+		defer func(e []encoder) { encoders = e }(slices.Clone(encoders))
+		RegisterEncoder("text/csv", CSVEncoder(CSVOptions{}))
+
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept", "text/csv")
+		rr := httptest.NewRecorder()
+		err := Respond(rr, r, rows, RespondOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h := rr.Header().Get("Content-Type"); h != "text/csv; charset=utf-8" {
+			t.Errorf("Content-Type: %q", h)
+		}
+		if have, want := rr.Body.String(), "id,name\n1,\"x,y\"\n2,\"\"\"q\"\"\"\n"; have != want {
+			t.Errorf("\nhave: %q\nwant: %q", have, want)
+		}
+
+		// Invalid data should send an error page, rather than a 200 with the
+		// error page as the body.
+		rr = httptest.NewRecorder()
+		defer func(l *slog.Logger) { slog.SetDefault(l) }(slog.Default())
+		slog.SetDefault(slog.New(slog.DiscardHandler))
+		Wrap(func(w http.ResponseWriter, r *http.Request) error {
+			return Respond(w, r, 42, RespondOptions{})
+		})(rr, r)
+		if rr.Code != 500 {
+			t.Errorf("wrong code: %d", rr.Code)
+		}
+		if h := rr.Header().Get("Content-Type"); h == "text/csv; charset=utf-8" {
+			t.Errorf("Content-Type: %q", h)
+		}
+	})
+}
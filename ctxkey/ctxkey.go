@@ -3,6 +3,8 @@ package ctxkey
 
 // Context keys.
 var (
-	User = &struct{ n string }{"u"}
-	Site = &struct{ n string }{"s"}
+	User       = &struct{ n string }{"u"}
+	Site       = &struct{ n string }{"s"}
+	ClientCert = &struct{ n string }{"c"} // *auth.ClientIdentity
+	Language   = &struct{ n string }{"l"}
 )
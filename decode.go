@@ -1,6 +1,7 @@
 package zhttp
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -51,6 +52,10 @@ func (e ErrorDecodeUnknown) Error() string {
 	return fmt.Sprintf("unknown parameter: %q", e.Field)
 }
 
+func (e ErrorDecodeUnknown) translate(ctx context.Context) string {
+	return T(ctx, "unknown parameter: %q", e.Field)
+}
+
 func (e ErrorDecode) Unwrap() error { return e.err }
 func (e ErrorDecode) Error() string {
 	var s string
@@ -67,6 +72,19 @@ func (e ErrorDecode) Error() string {
 	return s + e.err.Error()
 }
 
+func (e ErrorDecode) translate(ctx context.Context) string {
+	switch e.ct {
+	case ContentQuery:
+		return T(ctx, "invalid query parameters: %s", e.err)
+	case ContentForm:
+		return T(ctx, "invalid form data: %s", e.err)
+	case ContentJSON:
+		return T(ctx, "invalid JSON: %s", e.err)
+	default:
+		return T(ctx, "unsupported Content-Type")
+	}
+}
+
 var formamOpts = &formam.DecoderOptions{
 	TagName:     "json",
 	TimeFormats: []string{"2006-01-02", time.RFC3339},
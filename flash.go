@@ -4,8 +4,11 @@ import (
 	"encoding/base64"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
+
+	"zgo.at/json"
 )
 
 // Level constants.
@@ -14,7 +17,10 @@ const (
 	LevelError = "e"
 )
 
-const cookieFlash = "flash"
+const (
+	cookieFlash     = "flash"
+	cookieFlashForm = "flash_form"
+)
 
 // CookieSameSiteHelper can be used to set the SameSite attribute on cookies
 // (auth and flash).
@@ -30,14 +36,18 @@ var (
 
 // Flash sets a new flash message at the LevelInfo, overwriting any previous
 // messages (if any).
+//
+// The message is translated with the [Translator], if any.
 func Flash(w http.ResponseWriter, r *http.Request, msg string) {
-	flash(w, r, LevelInfo, msg)
+	flash(w, r, LevelInfo, translate(r.Context(), msg))
 }
 
 // FlashError sets a new flash message at the LevelError, overwriting any
 // previous messages (if any).
+//
+// The message is translated with the [Translator], if any.
 func FlashError(w http.ResponseWriter, r *http.Request, msg string) {
-	flash(w, r, LevelError, msg)
+	flash(w, r, LevelError, translate(r.Context(), msg))
 }
 
 // FlashMessage is a displayed flash message.
@@ -107,6 +117,99 @@ func flash(w http.ResponseWriter, r *http.Request, lvl, msg string) {
 	})
 }
 
+// FlashForm is the state of a form that failed validation, set with
+// [FlashFormErrors].
+type FlashForm struct {
+	Errors map[string][]string `json:"errors"` // Messages by field name.
+	Values url.Values          `json:"values"` // Submitted values.
+}
+
+// Error gets the first error message for the field, or "" if there is none.
+func (f *FlashForm) Error(field string) string {
+	if f == nil || len(f.Errors[field]) == 0 {
+		return ""
+	}
+	return f.Errors[field][0]
+}
+
+// Value gets the submitted value for the field.
+func (f *FlashForm) Value(field string) string {
+	if f == nil {
+		return ""
+	}
+	return f.Values.Get(field)
+}
+
+// Maximum size of the flash_form cookie; browsers typically allow 4096 bytes
+// for the entire cookie.
+const maxFlashForm = 3800
+
+// FlashFormErrors stores the validation errors and the submitted form values in
+// a cookie, so they can be displayed after redirecting back to the form with
+// [ReadFlashForm]. This is done by [DefaultErrPage] for [ValidationErrors].
+//
+// Fields that contain "password" in the name and the CSRF token aren't stored.
+// The values are dropped if the cookie would be too large.
+func FlashFormErrors(w http.ResponseWriter, r *http.Request, v *ValidationErrors, values url.Values) {
+	f := FlashForm{Errors: v.errors(), Values: make(url.Values, len(values))}
+	for k, val := range values {
+		if k == "csrf" || strings.Contains(strings.ToLower(k), "password") {
+			continue
+		}
+		f.Values[k] = val
+	}
+
+	j, err := json.Marshal(f)
+	if err == nil && base64.StdEncoding.EncodedLen(len(j)) > maxFlashForm {
+		f.Values = nil
+		j, err = json.Marshal(f)
+	}
+	if err != nil {
+		slog.Error("zhttp.FlashFormErrors", "err", err)
+		return
+	}
+
+	sameSite := http.SameSiteLaxMode
+	if CookieSameSiteHelper != nil {
+		sameSite = CookieSameSiteHelper(r)
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     cookieFlashForm,
+		Value:    base64.StdEncoding.EncodeToString(j),
+		Path:     CookiePath(),
+		Expires:  time.Now().Add(1 * time.Minute),
+		HttpOnly: true,
+		Secure:   IsSecure(r),
+		SameSite: sameSite,
+	})
+}
+
+// ReadFlashForm reads the form state set with [FlashFormErrors], returning nil
+// if there is none.
+//
+// The methods on FlashForm work with a nil value, so this can be used in
+// templates without checking for nil.
+func ReadFlashForm(w http.ResponseWriter, r *http.Request) *FlashForm {
+	c, err := r.Cookie(cookieFlashForm)
+	if err != nil || c.Value == "" {
+		return nil
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name: cookieFlashForm, Value: "", Path: CookiePath(),
+		Expires: time.Now().Add(-24 * time.Hour),
+	})
+
+	b, err := base64.StdEncoding.DecodeString(c.Value)
+	if err != nil {
+		return nil
+	}
+	var f FlashForm
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil
+	}
+	return &f
+}
+
 func readSetCookie(w http.ResponseWriter) *http.Cookie {
 	sk := w.Header().Get("Set-Cookie")
 	if sk == "" {
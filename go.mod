@@ -1,12 +1,16 @@
 module zgo.at/zhttp
 
-go 1.24
+go 1.24.0
 
 require (
 	// https://github.com/monoculum/formam/pull/49
 	github.com/monoculum/formam/v3 v3.6.1-0.20221106124510-6a93f49ac1f8
+	golang.org/x/crypto v0.45.0
+	golang.org/x/net v0.47.0
 	zgo.at/guru v1.2.0
 	zgo.at/json v0.0.0-20221020004326-fe4f75bb278e
 	zgo.at/zstd v0.0.0-20251128053228-ec259dea6715
 	zgo.at/ztpl v0.0.0-20250628022642-3b2c314e8e05
 )
+
+require golang.org/x/text v0.31.0 // indirect
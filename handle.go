@@ -0,0 +1,87 @@
+package zhttp
+
+import (
+	"context"
+	"net/http"
+)
+
+// HandleOptions are options for [HandleWith].
+type HandleOptions struct {
+	// Decoder to use; uses DefaultDecoder if nil.
+	Decoder *Decoder
+
+	// Template to render for clients that accept HTML; see [RespondOptions].
+	Template string
+
+	// Status code to use on success; default is 200.
+	Status int
+}
+
+// Handle creates a handler that decodes the request into In, calls f, and sends
+// the output.
+//
+// This is the same as [HandleWith] with the default options.
+func Handle[In, Out any](f func(context.Context, *http.Request, In) (Out, error)) http.HandlerFunc {
+	return HandleWith(HandleOptions{}, f)
+}
+
+// HandleWith creates a handler that decodes the request into In, calls f, and
+// sends the output.
+//
+// The request is decoded with [Decoder.Decode]; requests without a body aren't
+// decoded, so In can be struct{} if there are no parameters. If In has a
+// Validate() error method then it's called after decoding.
+//
+// The output is sent with [Respond], using the Template if it's set and the
+// client accepts HTML. The output is always encoded as JSON, so a string Out is
+// sent as a JSON string.
+//
+// Any errors from decoding, validating, f, or sending the output are sent to
+// [ErrPage].
+//
+//	type (
+//	    getUserIn  struct{ ID int64 `json:"id"` }
+//	    getUserOut struct{ Email string `json:"email"` }
+//	)
+//
+//	r.Get("/user", zhttp.Handle(func(ctx context.Context, r *http.Request, in getUserIn) (getUserOut, error) {
+//	    u, err := getUser(ctx, in.ID)
+//	    return getUserOut{Email: u.Email}, err
+//	}))
+func HandleWith[In, Out any](opts HandleOptions, f func(context.Context, *http.Request, In) (Out, error)) http.HandlerFunc {
+	dec := DefaultDecoder
+	if opts.Decoder != nil {
+		dec = *opts.Decoder
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		ww, ok := w.(ResponseWriter)
+		if !ok {
+			ww = NewResponseWriter(w, r.ProtoMajor)
+		}
+		ErrPage(ww, r, handle(ww, r, dec, opts, f))
+	}
+}
+
+func handle[In, Out any](w ResponseWriter, r *http.Request, dec Decoder, opts HandleOptions,
+	f func(context.Context, *http.Request, In) (Out, error),
+) error {
+	var in In
+	if r.Method == http.MethodGet || r.ContentLength != 0 || r.Header.Get("Content-Type") != "" {
+		_, err := dec.Decode(r, &in)
+		if err != nil {
+			return err
+		}
+	}
+	if v, ok := any(&in).(interface{ Validate() error }); ok {
+		if err := v.Validate(); err != nil {
+			return err
+		}
+	}
+
+	out, err := f(r.Context(), r, in)
+	if err != nil {
+		return err
+	}
+
+	return Respond(w, r, out, RespondOptions{Template: opts.Template, Status: opts.Status})
+}
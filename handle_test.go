@@ -0,0 +1,110 @@
+package zhttp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"zgo.at/guru"
+	"zgo.at/zstd/ztest"
+	"zgo.at/ztpl"
+)
+
+type handleIn struct {
+	Name string `json:"name"`
+}
+
+func (in handleIn) Validate() error {
+	v := new(ValidationErrors)
+	if in.Name == "" {
+		v.Append("name", "must be set")
+	}
+	return v.ErrorOrNil()
+}
+
+type handleOut struct {
+	Greeting string `json:"greeting"`
+}
+
+func TestHandle(t *testing.T) {
+	err := ztpl.Init(fstest.MapFS{"hello.gohtml": {Data: []byte(`<p>{{.Greeting}}</p>`)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := func(ctx context.Context, r *http.Request, in handleIn) (handleOut, error) {
+		if in.Name == "error" {
+			return handleOut{}, guru.New(409, "oh noes")
+		}
+		return handleOut{Greeting: "Hello, " + in.Name}, nil
+	}
+
+	tests := []struct {
+		name         string
+		opts         HandleOptions
+		method, path string
+		ct, body     string
+		accept       string
+		wantCode     int
+		wantBody     string
+	}{
+		{"query", HandleOptions{}, "GET", "/?name=x", "", "", "",
+			200, `{
+  "greeting": "Hello, x"
+}`},
+		{"json", HandleOptions{}, "POST", "/", "application/json", `{"name":"x"}`, "",
+			200, `{
+  "greeting": "Hello, x"
+}`},
+		{"form", HandleOptions{Status: 201}, "POST", "/", "application/x-www-form-urlencoded", `name=x`, "application/json",
+			201, `{
+  "greeting": "Hello, x"
+}`},
+		{"validate", HandleOptions{}, "POST", "/", "application/json", `{}`, "application/json",
+			400, `{"errors":{"name":["must be set"]}}`},
+		{"decode error", HandleOptions{}, "POST", "/", "application/json", `{`, "application/json",
+			400, `{"error":"invalid JSON: unexpected EOF"}`},
+		{"error", HandleOptions{}, "GET", "/?name=error", "", "", "application/json",
+			409, `{"error":"oh noes"}`},
+		{"template", HandleOptions{Template: "hello.gohtml"}, "GET", "/?name=x", "", "", "text/html",
+			200, `<p>Hello, x</p>`},
+		{"template json", HandleOptions{Template: "hello.gohtml"}, "GET", "/?name=x", "", "", "application/json",
+			200, `{
+  "greeting": "Hello, x"
+}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.ct != "" {
+				r.Header.Set("Content-Type", tt.ct)
+			}
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+			rr := httptest.NewRecorder()
+			HandleWith(tt.opts, f)(rr, r)
+
+			ztest.Code(t, rr, tt.wantCode)
+			if have := strings.TrimSpace(rr.Body.String()); have != tt.wantBody {
+				t.Errorf("\nhave: %s\nwant: %s", have, tt.wantBody)
+			}
+		})
+	}
+
+	t.Run("no input", func(t *testing.T) {
+		h := Handle(func(ctx context.Context, r *http.Request, in struct{}) (string, error) {
+			return `say "hi"`, nil
+		})
+		rr := httptest.NewRecorder()
+		h(rr, httptest.NewRequest("POST", "/", nil))
+		ztest.Code(t, rr, 200)
+		if have := rr.Body.String(); have != `"say \"hi\""`+"\n" {
+			t.Errorf("wrong body: %s", have)
+		}
+	})
+}
@@ -0,0 +1,103 @@
+package header
+
+import "strings"
+
+// Negotiate gets the best offer for the Accept* header specs, as returned by
+// [ParseAccept].
+//
+// The most specific matching spec is used for the quality of an offer (e.g.
+// "text/html" over "text/*" over "*/*"), and the offer with the highest
+// quality is returned. Earlier offers are preferred if the quality is equal.
+//
+// This returns the first offer if there are no specs, and "" if none of the
+// offers are acceptable.
+func Negotiate(specs []AcceptSpec, offers ...string) string {
+	if len(offers) == 0 {
+		return ""
+	}
+	if len(specs) == 0 {
+		return offers[0]
+	}
+
+	var (
+		best  string
+		bestQ float64
+	)
+	for _, o := range offers {
+		q, prec := 0.0, 0
+		for _, s := range specs {
+			p := acceptMatch(s.Value, o)
+			if p > prec {
+				q, prec = s.Q, p
+			}
+		}
+		if q > bestQ {
+			best, bestQ = o, q
+		}
+	}
+	return best
+}
+
+// acceptMatch returns how specific spec matches the offer: 0 for no match, 1
+// for "*/*", 2 for "type/*", and 3 for "type/subtype".
+func acceptMatch(spec, offer string) int {
+	switch {
+	case strings.EqualFold(spec, offer):
+		return 3
+	case spec == "*/*" || spec == "*":
+		return 1
+	case strings.HasSuffix(spec, "/*"):
+		t, _, _ := strings.Cut(offer, "/")
+		if strings.EqualFold(spec[:len(spec)-2], t) {
+			return 2
+		}
+	}
+	return 0
+}
+
+// NegotiateLanguage gets the best language for the Accept-Language header
+// specs, as returned by [ParseAccept].
+//
+// Languages are matched case-insensitive on the full tag first, and then on the
+// primary language: "nl-BE" will match "nl", and "pt" will match "pt-BR". The
+// first offer is returned if there are no specs or nothing matches.
+func NegotiateLanguage(specs []AcceptSpec, offers ...string) string {
+	if len(offers) == 0 {
+		return ""
+	}
+
+	var (
+		best  string
+		bestQ float64
+	)
+	for _, s := range specs {
+		if s.Q <= bestQ {
+			continue
+		}
+		if o := matchLanguage(s.Value, offers); o != "" {
+			best, bestQ = o, s.Q
+		}
+	}
+	if best == "" {
+		return offers[0]
+	}
+	return best
+}
+
+func matchLanguage(spec string, offers []string) string {
+	if spec == "*" {
+		return offers[0]
+	}
+	for _, o := range offers {
+		if strings.EqualFold(spec, o) {
+			return o
+		}
+	}
+	prim, _, _ := strings.Cut(spec, "-")
+	for _, o := range offers {
+		if p, _, _ := strings.Cut(o, "-"); strings.EqualFold(prim, p) {
+			return o
+		}
+	}
+	return ""
+}
@@ -0,0 +1,71 @@
+package header
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	offers := []string{"text/html", "application/json", "text/plain"}
+	tests := []struct {
+		accept, want string
+	}{
+		{"", "text/html"},
+		{"*/*", "text/html"},
+		{"application/json", "application/json"},
+		{"APPLICATION/JSON", "application/json"},
+		{"application/json, */*;q=0.8", "application/json"},
+		{"text/html;q=0.5, application/json;q=0.9", "application/json"},
+		{"text/*", "text/html"},
+		{"text/*, text/html;q=0", "text/plain"},
+		{"*/*, text/html;q=0", "application/json"},
+		{"image/png", ""},
+		{"text/html;q=0", ""},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", "text/html"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			h := http.Header{}
+			if tt.accept != "" {
+				h.Set("Accept", tt.accept)
+			}
+			have := Negotiate(ParseAccept(h, "Accept"), offers...)
+			if have != tt.want {
+				t.Errorf("\nhave: %q\nwant: %q", have, tt.want)
+			}
+		})
+	}
+}
+
+func TestNegotiateLanguage(t *testing.T) {
+	offers := []string{"en", "nl", "pt-BR", "pt-PT"}
+	tests := []struct {
+		accept, want string
+	}{
+		{"", "en"},
+		{"*", "en"},
+		{"nl", "nl"},
+		{"NL", "nl"},
+		{"nl-BE", "nl"},
+		{"pt", "pt-BR"},
+		{"pt-PT", "pt-PT"},
+		{"de", "en"},
+		{"de, nl;q=0.5", "nl"},
+		{"en;q=0.2, nl-NL;q=0.8, pt-PT", "pt-PT"},
+		{"nl;q=0.5, en;q=0.9", "en"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			h := http.Header{}
+			if tt.accept != "" {
+				h.Set("Accept-Language", tt.accept)
+			}
+			have := NegotiateLanguage(ParseAccept(h, "Accept-Language"), offers...)
+			if have != tt.want {
+				t.Errorf("\nhave: %q\nwant: %q", have, tt.want)
+			}
+		})
+	}
+}
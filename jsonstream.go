@@ -0,0 +1,141 @@
+package zhttp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"zgo.at/json"
+)
+
+// JSONStream writes a stream of JSON values; use [NewJSONArray] or
+// [NewNDJSON] to create one.
+//
+// The values are encoded in the same way as [JSON]: nil slices are written as
+// [] rather than null. The output is flushed every FlushInterval, and Write()
+// returns the context error once the client disconnects.
+type JSONStream struct {
+	// Flush the output if it's been longer than this since the last flush;
+	// the default is 1 second. Set to 0 to flush after every write.
+	FlushInterval time.Duration
+
+	w         http.ResponseWriter
+	rc        *http.ResponseController
+	ctx       context.Context
+	buf       bytes.Buffer
+	enc       *json.Encoder
+	array     bool
+	n         int
+	lastFlush time.Time
+}
+
+// NewJSONArray creates a stream to write a JSON array, one item at a time.
+//
+// The Content-Type is application/json, and the array is indented in the same
+// way as [JSON]. Close() must be called to write the closing bracket:
+//
+//	s := zhttp.NewJSONArray(w, r)
+//	for row := range rows {
+//	    err := s.Write(row)
+//	    if err != nil {
+//	        return err
+//	    }
+//	}
+//	return s.Close()
+func NewJSONArray(w http.ResponseWriter, r *http.Request) *JSONStream {
+	s := newJSONStream(w, r)
+	s.array = true
+	s.enc.SetIndent("  ", "  ")
+	return s
+}
+
+// NewNDJSON creates a stream to write newline-delimited JSON
+// (application/x-ndjson), with one value per line.
+func NewNDJSON(w http.ResponseWriter, r *http.Request) *JSONStream {
+	return newJSONStream(w, r)
+}
+
+func newJSONStream(w http.ResponseWriter, r *http.Request) *JSONStream {
+	s := &JSONStream{
+		FlushInterval: time.Second,
+		w:             w,
+		rc:            http.NewResponseController(w),
+		ctx:           r.Context(),
+		lastFlush:     time.Now(),
+	}
+	s.enc = json.NewEncoder(&s.buf)
+	s.enc.NullArray(false)
+	return s
+}
+
+// Write a value.
+//
+// The status code and headers are written on the first call, so errors from
+// before that can still be sent with [ErrPage].
+func (s *JSONStream) Write(v any) error {
+	if err := s.ctx.Err(); err != nil {
+		return err
+	}
+
+	s.buf.Reset()
+	if err := s.enc.Encode(v); err != nil {
+		return fmt.Errorf("zhttp.JSONStream.Write: %w", err)
+	}
+	b := s.buf.Bytes()
+	if s.array {
+		b = bytes.TrimSuffix(b, []byte("\n"))
+	}
+
+	if s.n == 0 {
+		s.writeHeader()
+		if s.array {
+			s.w.Write([]byte("[\n  "))
+		}
+	} else if s.array {
+		s.w.Write([]byte(",\n  "))
+	}
+	s.n++
+	if _, err := s.w.Write(b); err != nil {
+		return err
+	}
+
+	if time.Since(s.lastFlush) >= s.FlushInterval {
+		return s.Flush()
+	}
+	return nil
+}
+
+// Flush any buffered output to the client.
+func (s *JSONStream) Flush() error {
+	s.lastFlush = time.Now()
+	err := s.rc.Flush()
+	if errors.Is(err, http.ErrNotSupported) {
+		return nil
+	}
+	return err
+}
+
+// Close the stream, writing the closing bracket for arrays and flushing the
+// output. This doesn't close the connection.
+func (s *JSONStream) Close() error {
+	if s.n == 0 {
+		s.writeHeader()
+		if s.array {
+			s.w.Write([]byte("[]\n"))
+		}
+	} else if s.array {
+		s.w.Write([]byte("\n]\n"))
+	}
+	return s.Flush()
+}
+
+func (s *JSONStream) writeHeader() {
+	if s.array {
+		writeStatus(s.w, 200, "application/json; charset=utf-8")
+	} else {
+		writeStatus(s.w, 200, "application/x-ndjson")
+	}
+}
@@ -0,0 +1,100 @@
+package zhttp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestJSONStream(t *testing.T) {
+	type item struct {
+		ID   int      `json:"id"`
+		Tags []string `json:"tags"`
+	}
+	items := []item{{ID: 1}, {ID: 2, Tags: []string{"a"}}}
+
+	t.Run("array", func(t *testing.T) {
+		for _, items := range [][]item{items, {}} {
+			want := httptest.NewRecorder()
+			JSON(want, items)
+
+			rr := httptest.NewRecorder()
+			s := NewJSONArray(rr, httptest.NewRequest("GET", "/", nil))
+			for _, it := range items {
+				if err := s.Write(it); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := s.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			if have, want := rr.Body.String(), want.Body.String(); have != want {
+				t.Errorf("\nhave: %q\nwant: %q", have, want)
+			}
+			if ct := rr.Header().Get("Content-Type"); ct != "application/json; charset=utf-8" {
+				t.Errorf("wrong Content-Type: %q", ct)
+			}
+		}
+	})
+
+	t.Run("ndjson", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		s := NewNDJSON(rr, httptest.NewRequest("GET", "/", nil))
+		s.FlushInterval = 0
+		for _, it := range items {
+			if err := s.Write(it); err != nil {
+				t.Fatal(err)
+			}
+			if !rr.Flushed {
+				t.Error("not flushed")
+			}
+		}
+		if err := s.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		want := "{\"id\":1,\"tags\":[]}\n{\"id\":2,\"tags\":[\"a\"]}\n"
+		if have := rr.Body.String(); have != want {
+			t.Errorf("\nhave: %q\nwant: %q", have, want)
+		}
+		if ct := rr.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+			t.Errorf("wrong Content-Type: %q", ct)
+		}
+	})
+
+	t.Run("disconnect", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		rr := httptest.NewRecorder()
+		s := NewNDJSON(rr, httptest.NewRequest("GET", "/", nil).WithContext(ctx))
+		if err := s.Write(items[0]); err != nil {
+			t.Fatal(err)
+		}
+		cancel()
+		if err := s.Write(items[1]); err != context.Canceled {
+			t.Errorf("wrong error: %v", err)
+		}
+	})
+
+	t.Run("no flush", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		w := struct{ http.ResponseWriter }{rr} // Hide Flush()
+		s := NewNDJSON(w, httptest.NewRequest("GET", "/", nil))
+		s.FlushInterval = 0
+		for _, it := range items {
+			if err := s.Write(it); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := s.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if rr.Flushed {
+			t.Error("flushed")
+		}
+		if have, want := rr.Body.String(), "{\"id\":1,\"tags\":[]}\n{\"id\":2,\"tags\":[\"a\"]}\n"; have != want {
+			t.Errorf("\nhave: %q\nwant: %q", have, want)
+		}
+	})
+}
@@ -0,0 +1,121 @@
+package zhttp
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+)
+
+// The first file descriptor passed by systemd; 0, 1, 2 are stdin, stdout, and
+// stderr.
+const listenFdsStart = 3
+
+// SystemdListeners returns the listeners passed with systemd socket
+// activation, in the order they're defined in the socket unit.
+//
+// This returns nil if the process wasn't started with socket activation; that
+// is, if LISTEN_PID doesn't match the current process or LISTEN_FDS isn't set.
+//
+// The LISTEN_PID, LISTEN_FDS, and LISTEN_FDNAMES environment variables are
+// unset, so they're not inherited by child processes. This means that calling
+// it a second time will always return nil.
+//
+// See sd_listen_fds(3) and systemd.socket(5).
+func SystemdListeners() ([]net.Listener, error) {
+	listeners, _, err := systemdListeners()
+	return listeners, err
+}
+
+// systemdListeners is like SystemdListeners, but also returns the names from
+// LISTEN_FDNAMES (set with FileDescriptorName= in the socket unit). Names may
+// be empty.
+func systemdListeners() ([]net.Listener, []string, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil, nil, nil
+	}
+	names := make([]string, n)
+	copy(names, strings.Split(os.Getenv("LISTEN_FDNAMES"), ":"))
+
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	listeners := make([]net.Listener, 0, n)
+	for fd := listenFdsStart; fd < listenFdsStart+n; fd++ {
+		f := os.NewFile(uintptr(fd), "LISTEN_FD_"+strconv.Itoa(fd))
+		// FileListener dup()s the file descriptor with close-on-exec set, so
+		// we can close the original.
+		ln, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, nil, fmt.Errorf("zhttp.SystemdListeners: fd %d: %w", fd, err)
+		}
+		listeners = append(listeners, ln)
+	}
+	return listeners, names, nil
+}
+
+// listenUnix listens on a unix socket, removing the socket file if it's left
+// over from a previous run.
+func listenUnix(path string, mode os.FileMode, group string) (net.Listener, error) {
+	st, err := os.Lstat(path)
+	if err == nil {
+		if st.Mode().Type() != fs.ModeSocket {
+			return nil, fmt.Errorf("listen unix %s: file exists and is not a socket", path)
+		}
+		// Don't remove the socket if something is still listening on it.
+		c, err := net.Dial("unix", path)
+		if err == nil {
+			c.Close()
+			return nil, fmt.Errorf("listen unix %s: socket is in use", path)
+		}
+		err = os.Remove(path)
+		if err != nil {
+			return nil, fmt.Errorf("listen unix %s: removing stale socket: %w", path, err)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("listen unix %s: %w", path, err)
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if mode != 0 {
+		err = os.Chmod(path, mode)
+		if err != nil {
+			ln.Close()
+			return nil, fmt.Errorf("listen unix %s: %w", path, err)
+		}
+	}
+	if group != "" {
+		g, err := user.LookupGroup(group)
+		if err != nil {
+			g, err = user.LookupGroupId(group)
+		}
+		if err != nil {
+			ln.Close()
+			return nil, fmt.Errorf("listen unix %s: %w", path, err)
+		}
+		gid, _ := strconv.Atoi(g.Gid)
+		err = os.Chown(path, -1, gid)
+		if err != nil {
+			ln.Close()
+			return nil, fmt.Errorf("listen unix %s: %w", path, err)
+		}
+	}
+	return ln, nil
+}
@@ -0,0 +1,164 @@
+package zhttp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestSystemdListeners(t *testing.T) {
+	if os.Getenv("ZHTTP_TEST_SYSTEMD") != "" {
+		systemdChild()
+		return
+	}
+	if runtime.GOOS == "windows" {
+		t.Skip("no socket activation on Windows")
+	}
+
+	listen := func() (*os.File, string) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ln.Close()
+		f, err := ln.(*net.TCPListener).File()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return f, ln.Addr().String()
+	}
+	f, addr := listen()
+	rf, raddr := listen()
+
+	// LISTEN_PID needs to be the PID of the child, which we only know after
+	// starting it; let the shell set it before exec.
+	cmd := exec.Command("sh", "-c", `LISTEN_PID=$$ exec "$0" -test.run=^TestSystemdListeners$`, os.Args[0])
+	cmd.Env = append(os.Environ(), "ZHTTP_TEST_SYSTEMD=1", "LISTEN_FDS=2", "LISTEN_FDNAMES=zhttp.socket:redirect")
+	cmd.ExtraFiles = []*os.File{f, rf}
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	rf.Close()
+
+	// The socket named "redirect" is used for the redirect server.
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get("http://" + raddr + "/path")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 301 {
+		t.Errorf("wrong status for redirect: %d", resp.StatusCode)
+	}
+
+	resp, err = http.Get("http://" + addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(b) != "systemd" {
+		t.Errorf("wrong body: %q", b)
+	}
+
+	if err := cmd.Wait(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Serve one request on the socket passed from systemd, and exit.
+func systemdChild() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := Server{
+		Server: &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Connection", "close")
+			w.Write([]byte("systemd"))
+			cancel()
+		})},
+		Redirect:     true,
+		RedirectPort: "1", // Not used, as it's passed from systemd.
+		Logger:       slog.New(slog.DiscardHandler),
+	}
+	err := s.Run(ctx)
+	if err != nil {
+		panic(err)
+	}
+	if os.Getenv("LISTEN_FDS") != "" {
+		panic("LISTEN_FDS still set")
+	}
+}
+
+func TestListenUnix(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no file mode for unix sockets on Windows")
+	}
+	sock := filepath.Join(t.TempDir(), "zhttp.sock")
+
+	// Leave a stale socket.
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	ln.Close()
+
+	s := Server{
+		Server: &http.Server{Addr: "unix:" + sock, Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("unix"))
+		})},
+		SocketMode: 0o660,
+		Logger:     slog.New(slog.DiscardHandler),
+	}
+	stop := startServer(t, &s)
+
+	st, err := os.Stat(sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := st.Mode().Perm(); p != 0o660 {
+		t.Errorf("wrong mode: %s", p)
+	}
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", sock)
+		},
+	}}
+	resp, err := client.Get("http://unix/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(b) != "unix" {
+		t.Errorf("wrong body: %q", b)
+	}
+
+	// Can't start a second server on the same socket.
+	_, err = listenUnix(sock, 0, "")
+	if err == nil || !strings.Contains(err.Error(), "in use") {
+		t.Errorf("wrong error: %v", err)
+	}
+
+	client.CloseIdleConnections()
+	if err := stop(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(sock); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("socket not removed: %v", err)
+	}
+}
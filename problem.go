@@ -0,0 +1,116 @@
+package zhttp
+
+import (
+	"errors"
+	"net/http"
+
+	"zgo.at/json"
+)
+
+// ProblemJSON sends errors as RFC 9457 problem details (application/problem+json)
+// to all JSON clients in [DefaultErrPage], rather than only to clients that
+// explicitly ask for it. Errors that aren't a [Problem] are converted to one.
+var ProblemJSON = false
+
+// Problem is an error with RFC 9457 problem details.
+//
+// [UserError] uses Status as the status code. For 404 and 5xx errors the Detail
+// is replaced in the same way as other errors, so internals aren't leaked. The
+// other fields are sent as-is.
+//
+// [DefaultErrPage] sends it as application/problem+json if the client asks for
+// it, or for all JSON clients if [ProblemJSON] is set. For other formats it's
+// displayed as any other error.
+//
+// See: https://www.rfc-editor.org/rfc/rfc9457
+type Problem struct {
+	Type     string // URI reference for the problem type; "about:blank" if empty.
+	Title    string // Short summary of the problem type; status text if empty.
+	Status   int    // HTTP status code; 500 if 0.
+	Detail   string // Explanation specific to this occurrence.
+	Instance string // URI reference for this occurrence.
+
+	// Extension members; these are added to the JSON object.
+	Extensions map[string]any
+
+	// Underlying error; this isn't sent to the client.
+	Err error
+}
+
+func (p *Problem) Error() string {
+	switch {
+	case p.Detail != "":
+		return p.Detail
+	case p.Title != "":
+		return p.Title
+	case p.Err != nil:
+		return p.Err.Error()
+	default:
+		return http.StatusText(p.Code())
+	}
+}
+
+func (p *Problem) Unwrap() error { return p.Err }
+
+// Code gets the HTTP status code.
+func (p *Problem) Code() int {
+	if p.Status == 0 {
+		return 500
+	}
+	return p.Status
+}
+
+// MarshalJSON writes the problem details object.
+func (p *Problem) MarshalJSON() ([]byte, error) {
+	m := make(map[string]any, len(p.Extensions)+5)
+	for k, v := range p.Extensions {
+		m[k] = v
+	}
+	if p.Type != "" {
+		m["type"] = p.Type
+	}
+	m["title"] = p.Title
+	if p.Title == "" && (p.Type == "" || p.Type == "about:blank") {
+		m["title"] = http.StatusText(p.Code())
+	}
+	m["status"] = p.Code()
+	if p.Detail != "" {
+		m["detail"] = p.Detail
+	}
+	if p.Instance != "" {
+		m["instance"] = p.Instance
+	}
+	return json.Marshal(m)
+}
+
+// userProblem returns a copy of the Problem in err (if any) with the user error
+// message as the Detail.
+func userProblem(err error, code int, userErr error) error {
+	var p *Problem
+	if !errors.As(err, &p) {
+		return userErr
+	}
+	cp := *p
+	cp.Status, cp.Detail, cp.Err = code, userErr.Error(), nil
+	return &cp
+}
+
+func errPageProblem(w http.ResponseWriter, r *http.Request, code int, userErr error) {
+	var (
+		p    *Problem
+		vErr *ValidationErrors
+	)
+	switch {
+	case errors.As(userErr, &p):
+	case errors.As(userErr, &vErr):
+		p = &Problem{Status: code, Detail: "validation failed",
+			Extensions: map[string]any{"errors": vErr.errors()}}
+	default:
+		p = &Problem{Status: code, Detail: userErr.Error()}
+	}
+	j, err := p.MarshalJSON()
+	if err != nil {
+		withRequest(r).Error(err.Error())
+	}
+	w.Write(j)
+}
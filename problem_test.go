@@ -0,0 +1,89 @@
+package zhttp
+
+import (
+	"errors"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"zgo.at/guru"
+	"zgo.at/zstd/ztest"
+)
+
+func TestProblem(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		accept      string
+		problemJSON bool
+		wantCode    int
+		wantCT      string
+		wantBody    string
+	}{
+		{"problem+json",
+			&Problem{Type: "https://example.com/out-of-credit", Title: "Out of credit", Status: 403,
+				Detail: "Balance is 30", Instance: "/account/1", Extensions: map[string]any{"balance": 30}},
+			"application/problem+json", false,
+			403, "application/problem+json",
+			`{"balance":30,"detail":"Balance is 30","instance":"/account/1","status":403,"title":"Out of credit","type":"https://example.com/out-of-credit"}`},
+		{"default title",
+			&Problem{Status: 409, Detail: "already exists"},
+			"application/problem+json", false,
+			409, "application/problem+json",
+			`{"detail":"already exists","status":409,"title":"Conflict"}`},
+		{"5xx hides detail",
+			&Problem{Status: 503, Detail: "secret", Err: errors.New("db is down")},
+			"application/problem+json", false,
+			503, "application/problem+json",
+			`{"detail":"unexpected error code ‘` + UserErrorCode(&Problem{Status: 503, Detail: "secret"}) + `’; this has been reported for investigation","status":503,"title":"Service Unavailable"}`},
+		{"404",
+			&Problem{Status: 404, Detail: "no such user: martin"},
+			"application/problem+json", false,
+			404, "application/problem+json",
+			`{"detail":"not found","status":404,"title":"Not Found"}`},
+		{"regular error",
+			errors.New("oh noes"),
+			"application/problem+json", false,
+			500, "application/problem+json",
+			`{"detail":"unexpected error code ‘` + UserErrorCode(errors.New("oh noes")) + `’; this has been reported for investigation","status":500,"title":"Internal Server Error"}`},
+		{"application/json",
+			&Problem{Status: 400, Detail: "wrong"},
+			"application/json", false,
+			400, "application/json",
+			`{"detail":"wrong","status":400,"title":"Bad Request"}`},
+		{"ProblemJSON",
+			guru.New(400, "bad"),
+			"application/json", true,
+			400, "application/problem+json",
+			`{"detail":"bad","status":400,"title":"Bad Request"}`},
+		{"text",
+			&Problem{Status: 400, Detail: "wrong"},
+			"text/plain", false,
+			400, "text/plain; charset=utf-8",
+			`Error 400: wrong`},
+	}
+
+	defer func(l *slog.Logger) { slog.SetDefault(l) }(slog.Default())
+	slog.SetDefault(slog.New(slog.DiscardHandler))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() { ProblemJSON = false }()
+			ProblemJSON = tt.problemJSON
+
+			rr := httptest.NewRecorder()
+			r := httptest.NewRequest("GET", "/", nil)
+			r.Header.Set("Accept", tt.accept)
+			DefaultErrPage(rr, r, tt.err)
+
+			ztest.Code(t, rr, tt.wantCode)
+			if have := rr.Header().Get("Content-Type"); have != tt.wantCT {
+				t.Errorf("wrong Content-Type: %q", have)
+			}
+			if have := strings.TrimSpace(rr.Body.String()); have != tt.wantBody {
+				t.Errorf("\nhave: %s\nwant: %s", have, tt.wantBody)
+			}
+		})
+	}
+}
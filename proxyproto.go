@@ -0,0 +1,303 @@
+package zhttp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProxyHeader is a parsed PROXY protocol header.
+//
+// See: https://www.haproxy.org/download/2.9/doc/proxy-protocol.txt
+type ProxyHeader struct {
+	Version int      // 1 or 2.
+	Source  net.Addr // Client address; nil for UNKNOWN (v1) or LOCAL (v2).
+	Dest    net.Addr // Address the client connected to.
+	TLVs    []ProxyTLV
+}
+
+// ProxyTLV is a type-length-value field in a PROXY v2 header.
+type ProxyTLV struct {
+	Type  byte
+	Value []byte
+}
+
+// TLV gets the value of the first TLV with the given type, or nil if there is
+// none.
+func (h ProxyHeader) TLV(typ byte) []byte {
+	for _, t := range h.TLVs {
+		if t.Type == typ {
+			return t.Value
+		}
+	}
+	return nil
+}
+
+type ctxProxyKey struct{}
+
+// GetProxyHeader gets the PROXY protocol header for the connection this request
+// was made on, or nil if there is none.
+func GetProxyHeader(ctx context.Context) *ProxyHeader {
+	c, _ := ctx.Value(ctxProxyKey{}).(*proxyConn)
+	if c == nil {
+		return nil
+	}
+	if c.readHeader() != nil {
+		return nil
+	}
+	return c.hdr
+}
+
+// ProxyListener wraps a listener to read the PROXY protocol (v1 or v2) header
+// sent by load balancers such as HAProxy or AWS NLB.
+//
+// The header is only accepted from addresses in one of the trusted CIDRs, and
+// is required for them. Connections from other addresses are used as-is.
+//
+// The RemoteAddr of the connection is set to the client address from the
+// header. Use [ProxyConnContext] as the http.Server.ConnContext to make the
+// header available with [GetProxyHeader].
+func ProxyListener(ln net.Listener, trusted ...string) (net.Listener, error) {
+	t, err := parsePrefixes(trusted)
+	if err != nil {
+		return nil, fmt.Errorf("zhttp.ProxyListener: %w", err)
+	}
+	return &proxyListener{Listener: ln, trusted: t}, nil
+}
+
+func parsePrefixes(cidrs []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(cidrs))
+	for _, c := range cidrs {
+		p, err := netip.ParsePrefix(c)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, p.Masked())
+	}
+	return prefixes, nil
+}
+
+// ProxyConnContext adds the connection to the context, so that
+// [GetProxyHeader] can read the header.
+func ProxyConnContext(ctx context.Context, c net.Conn) context.Context {
+	if nc, ok := c.(interface{ NetConn() net.Conn }); ok { // *tls.Conn
+		c = nc.NetConn()
+	}
+	if pc, ok := c.(*proxyConn); ok {
+		return context.WithValue(ctx, ctxProxyKey{}, pc)
+	}
+	return ctx
+}
+
+// Maximum time to wait for the PROXY header.
+const proxyHeaderTimeout = 10 * time.Second
+
+type proxyListener struct {
+	net.Listener
+	trusted []netip.Prefix
+}
+
+func (l *proxyListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if !l.isTrusted(c.RemoteAddr()) {
+		return c, nil
+	}
+	// Don't read the header here, as that would block Accept(); it's read on
+	// the first Read() or RemoteAddr() call.
+	return &proxyConn{Conn: c, r: bufio.NewReader(c)}, nil
+}
+
+func (l *proxyListener) isTrusted(addr net.Addr) bool {
+	ap, err := netip.ParseAddrPort(addr.String())
+	if err != nil {
+		return false
+	}
+	ip := ap.Addr().Unmap()
+	for _, p := range l.trusted {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+type proxyConn struct {
+	net.Conn
+	r    *bufio.Reader
+	once sync.Once
+	err  error
+	hdr  *ProxyHeader
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) {
+	if err := c.readHeader(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(b)
+}
+
+func (c *proxyConn) RemoteAddr() net.Addr {
+	if c.readHeader() == nil && c.hdr.Source != nil {
+		return c.hdr.Source
+	}
+	return c.Conn.RemoteAddr()
+}
+
+func (c *proxyConn) LocalAddr() net.Addr {
+	if c.readHeader() == nil && c.hdr.Dest != nil {
+		return c.hdr.Dest
+	}
+	return c.Conn.LocalAddr()
+}
+
+func (c *proxyConn) readHeader() error {
+	c.once.Do(func() {
+		c.Conn.SetReadDeadline(time.Now().Add(proxyHeaderTimeout))
+		c.hdr, c.err = parseProxyHeader(c.r)
+		c.Conn.SetReadDeadline(time.Time{})
+		if c.err != nil {
+			c.err = fmt.Errorf("zhttp: PROXY header from %s: %w", c.Conn.RemoteAddr(), c.err)
+			c.Conn.Close()
+		}
+	})
+	return c.err
+}
+
+var proxyV2Sig = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+func parseProxyHeader(r *bufio.Reader) (*ProxyHeader, error) {
+	sig, err := r.Peek(len(proxyV2Sig))
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case bytes.Equal(sig, proxyV2Sig):
+		return parseProxyV2(r)
+	case bytes.HasPrefix(sig, []byte("PROXY ")):
+		return parseProxyV1(r)
+	default:
+		return nil, errors.New("missing PROXY header")
+	}
+}
+
+// PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n
+func parseProxyV1(r *bufio.Reader) (*ProxyHeader, error) {
+	const maxLen = 107
+	var line []byte
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+		if len(line) >= maxLen {
+			return nil, errors.New("v1 header too long")
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, errors.New("v1 header doesn't end with CRLF")
+	}
+
+	f := strings.Split(string(line[:len(line)-2]), " ")
+	h := &ProxyHeader{Version: 1}
+	if len(f) >= 2 && f[1] == "UNKNOWN" {
+		return h, nil
+	}
+	if len(f) != 6 || (f[1] != "TCP4" && f[1] != "TCP6") {
+		return nil, fmt.Errorf("invalid v1 header: %q", line)
+	}
+	src, err := parseProxyAddr(f[2], f[4])
+	if err != nil {
+		return nil, err
+	}
+	dst, err := parseProxyAddr(f[3], f[5])
+	if err != nil {
+		return nil, err
+	}
+	h.Source, h.Dest = src, dst
+	return h, nil
+}
+
+func parseProxyAddr(ip, port string) (net.Addr, error) {
+	a, err := netip.ParseAddr(ip)
+	if err != nil {
+		return nil, fmt.Errorf("invalid v1 header: %w", err)
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid v1 header: %w", err)
+	}
+	return net.TCPAddrFromAddrPort(netip.AddrPortFrom(a, uint16(p))), nil
+}
+
+func parseProxyV2(r *bufio.Reader) (*ProxyHeader, error) {
+	var fixed [16]byte
+	if _, err := io.ReadFull(r, fixed[:]); err != nil {
+		return nil, err
+	}
+	if fixed[12]>>4 != 2 {
+		return nil, fmt.Errorf("unsupported v2 version: %d", fixed[12]>>4)
+	}
+	body := make([]byte, binary.BigEndian.Uint16(fixed[14:]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+
+	h := &ProxyHeader{Version: 2}
+	var (
+		cmd    = fixed[12] & 0xf
+		family = fixed[13] >> 4
+		alen   int
+	)
+	switch family {
+	case 0x1: // AF_INET
+		alen = 12
+	case 0x2: // AF_INET6
+		alen = 36
+	case 0x3: // AF_UNIX
+		alen = 216
+	}
+	if len(body) < alen {
+		return nil, errors.New("v2 header too short for address")
+	}
+
+	// Only use the addresses for PROXY; LOCAL is used for e.g. health checks
+	// by the proxy itself.
+	if cmd == 0x1 && (family == 0x1 || family == 0x2) {
+		n := alen/2 - 2
+		src, _ := netip.AddrFromSlice(body[:n])
+		dst, _ := netip.AddrFromSlice(body[n : 2*n])
+		h.Source = net.TCPAddrFromAddrPort(netip.AddrPortFrom(src, binary.BigEndian.Uint16(body[2*n:])))
+		h.Dest = net.TCPAddrFromAddrPort(netip.AddrPortFrom(dst, binary.BigEndian.Uint16(body[2*n+2:])))
+	}
+
+	tlv := body[alen:]
+	for len(tlv) > 0 {
+		if len(tlv) < 3 {
+			return nil, errors.New("truncated v2 TLV")
+		}
+		l := int(binary.BigEndian.Uint16(tlv[1:3]))
+		if len(tlv) < 3+l {
+			return nil, errors.New("truncated v2 TLV")
+		}
+		h.TLVs = append(h.TLVs, ProxyTLV{Type: tlv[0], Value: tlv[3 : 3+l]})
+		tlv = tlv[3+l:]
+	}
+	return h, nil
+}
@@ -0,0 +1,131 @@
+package zhttp
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestProxyProtocol(t *testing.T) {
+	start := func(t *testing.T, trusted ...string) string {
+		s := Server{
+			Server: &http.Server{Addr: "127.0.0.1:0", Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, r.RemoteAddr)
+				if h := GetProxyHeader(r.Context()); h != nil {
+					fmt.Fprintf(w, " v%d %q", h.Version, h.TLV(0x02))
+				}
+			})},
+			ProxyProtocol: trusted,
+			Logger:        slog.New(slog.DiscardHandler),
+		}
+		startServer(t, &s)
+		return s.Server.Addr
+	}
+
+	v2 := func(cmd byte, tlv ...byte) string {
+		addr := []byte{
+			192, 0, 2, 1, // src
+			192, 0, 2, 2, // dst
+			0x30, 0x39, // 12345
+			0x01, 0xbb, // 443
+		}
+		fam := byte(0x11) // TCP over IPv4
+		if cmd == 0 {
+			addr, fam = nil, 0x00
+		}
+		body := append(addr, tlv...)
+		return string(proxyV2Sig) + string([]byte{0x20 | cmd, fam, 0, byte(len(body))}) + string(body)
+	}
+
+	tests := []struct {
+		name, trusted, header, want string
+	}{
+		{"v1", "127.0.0.0/8",
+			"PROXY TCP4 192.0.2.1 192.0.2.2 12345 443\r\n",
+			`192.0.2.1:12345 v1 ""`},
+		{"v1 ipv6", "127.0.0.0/8",
+			"PROXY TCP6 2001:db8::1 2001:db8::2 12345 443\r\n",
+			`[2001:db8::1]:12345 v1 ""`},
+		{"v1 unknown", "127.0.0.0/8",
+			"PROXY UNKNOWN\r\n",
+			`127.0.0.1:`},
+		{"v2", "127.0.0.0/8",
+			v2(1, 0x02, 0, 11, 'e', 'x', 'a', 'm', 'p', 'l', 'e', '.', 'c', 'o', 'm'),
+			`192.0.2.1:12345 v2 "example.com"`},
+		{"v2 local", "127.0.0.0/8",
+			v2(0),
+			`127.0.0.1:`},
+		{"missing header", "127.0.0.0/8",
+			"",
+			``},
+		{"untrusted", "10.0.0.0/8",
+			"PROXY TCP4 192.0.2.1 192.0.2.2 12345 443\r\n",
+			`HTTP/1.1 400 Bad Request`},
+		{"untrusted without header", "10.0.0.0/8",
+			"",
+			`127.0.0.1:`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr := start(t, tt.trusted)
+
+			c, err := net.Dial("tcp", addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+			fmt.Fprint(c, tt.header+"GET / HTTP/1.1\r\nHost: example.com\r\nConnection: close\r\n\r\n")
+
+			resp, _ := io.ReadAll(c)
+			have := string(resp)
+			if tt.want == "" { // Connection closed without response.
+				if have != "" {
+					t.Errorf("expected no response; have: %q", have)
+				}
+				return
+			}
+			if i := strings.Index(have, "\r\n\r\n"); i > -1 && !strings.HasPrefix(tt.want, "HTTP/") {
+				have = have[i+4:]
+			}
+			if !strings.HasPrefix(have, tt.want) {
+				t.Errorf("\nhave: %q\nwant: %q", have, tt.want)
+			}
+		})
+	}
+}
+
+func TestProxyProtocolRedirect(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, rport, _ := net.SplitHostPort(ln.Addr().String())
+	ln.Close()
+
+	s := Server{
+		Server:        &http.Server{Addr: "127.0.0.1:0"},
+		Redirect:      true,
+		RedirectPort:  rport,
+		ProxyProtocol: []string{"127.0.0.0/8"},
+		Logger:        slog.New(slog.DiscardHandler),
+	}
+	startServer(t, &s)
+
+	c, err := net.Dial("tcp", "127.0.0.1:"+rport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	fmt.Fprint(c, "PROXY TCP4 192.0.2.1 192.0.2.2 12345 80\r\n"+
+		"GET /path HTTP/1.1\r\nHost: example.com\r\nConnection: close\r\n\r\n")
+
+	resp, _ := io.ReadAll(c)
+	if have := string(resp); !strings.HasPrefix(have, "HTTP/1.1 301 ") {
+		t.Errorf("wrong response:\n%s", have)
+	}
+}
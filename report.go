@@ -0,0 +1,103 @@
+package zhttp
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrReporter is called by [DefaultErrPage] for 5xx errors, in addition to
+// logging them. This can be used to send errors to an error tracker or email.
+//
+// Use [RateLimitReporter] to avoid getting flooded with identical errors.
+var ErrReporter ErrorReporter
+
+// ErrorReporter reports errors.
+//
+// This is called synchronously from the request; implementations that do
+// something slow, such as sending email, should do that in the background.
+type ErrorReporter interface {
+	ReportError(ErrorReport)
+}
+
+// ErrorReporterFunc is an adapter to use a function as an [ErrorReporter].
+type ErrorReporterFunc func(ErrorReport)
+
+func (f ErrorReporterFunc) ReportError(r ErrorReport) { f(r) }
+
+// ErrorReport is a reported error.
+type ErrorReport struct {
+	Err     error         // Reported error.
+	Code    string        // Error code from UserErrorCode(); this is shown to the user.
+	Status  int           // HTTP status code.
+	Stack   string        // Stack trace, if the error has one.
+	Request *http.Request // Request that caused the error.
+
+	// Number of times the error occurred since the last report; this is
+	// always 1 unless [RateLimitReporter] is used. Err and Request are from
+	// the last occurrence.
+	Count int
+}
+
+// RateLimitReporter groups errors by the error code, and reports every error
+// at most once per interval.
+//
+// The first occurrence of an error is reported immediately. Any further
+// occurrences in the interval are counted, and reported as one ErrorReport
+// once the interval has passed.
+//
+// Note that the Request may be reported after the request is finished, and
+// the body may no longer be readable.
+func RateLimitReporter(r ErrorReporter, interval time.Duration) ErrorReporter {
+	return &rateLimitReporter{
+		r:        r,
+		interval: interval,
+		groups:   make(map[string]*reportGroup),
+	}
+}
+
+type (
+	rateLimitReporter struct {
+		r        ErrorReporter
+		interval time.Duration
+		mu       sync.Mutex
+		groups   map[string]*reportGroup
+	}
+	reportGroup struct {
+		last  ErrorReport
+		count int
+	}
+)
+
+func (rl *rateLimitReporter) ReportError(e ErrorReport) {
+	rl.mu.Lock()
+	if g, ok := rl.groups[e.Code]; ok {
+		g.last, g.count = e, g.count+1
+		rl.mu.Unlock()
+		return
+	}
+	rl.groups[e.Code] = &reportGroup{}
+	time.AfterFunc(rl.interval, func() { rl.flush(e.Code) })
+	rl.mu.Unlock()
+
+	e.Count = 1
+	rl.r.ReportError(e)
+}
+
+// Report any errors that occurred during the interval, and keep suppressing
+// errors for another interval if there were any.
+func (rl *rateLimitReporter) flush(code string) {
+	rl.mu.Lock()
+	g := rl.groups[code]
+	if g.count == 0 {
+		delete(rl.groups, code)
+		rl.mu.Unlock()
+		return
+	}
+	e := g.last
+	e.Count, g.count = g.count, 0
+	time.AfterFunc(rl.interval, func() { rl.flush(code) })
+	rl.mu.Unlock()
+
+	rl.r.ReportError(e)
+}
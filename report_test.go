@@ -0,0 +1,77 @@
+package zhttp
+
+import (
+	"errors"
+	"log/slog"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"zgo.at/guru"
+)
+
+func TestRateLimitReporter(t *testing.T) {
+	reports := make(chan ErrorReport, 10)
+	rl := RateLimitReporter(ErrorReporterFunc(func(e ErrorReport) { reports <- e }), 50*time.Millisecond)
+
+	recv := func(want int) {
+		t.Helper()
+		select {
+		case e := <-reports:
+			if e.Count != want {
+				t.Errorf("wrong count for %s\nhave: %d\nwant: %d", e.Code, e.Count, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("no report")
+		}
+	}
+	none := func() {
+		t.Helper()
+		select {
+		case e := <-reports:
+			t.Fatalf("unexpected report: %v", e)
+		default:
+		}
+	}
+
+	for range 5 {
+		rl.ReportError(ErrorReport{Code: "a"})
+	}
+	rl.ReportError(ErrorReport{Code: "b"})
+	recv(1) // a
+	recv(1) // b
+	none()
+
+	recv(4) // Rest of a after the interval.
+	none()
+
+	// Nothing happened in the interval, so should be reported immediately
+	// again.
+	time.Sleep(120 * time.Millisecond)
+	rl.ReportError(ErrorReport{Code: "a"})
+	recv(1)
+}
+
+func TestErrPageReporter(t *testing.T) {
+	defer func(l *slog.Logger) { slog.SetDefault(l) }(slog.Default())
+	slog.SetDefault(slog.New(slog.DiscardHandler))
+
+	var reports []ErrorReport
+	ErrReporter = ErrorReporterFunc(func(e ErrorReport) { reports = append(reports, e) })
+	defer func() { ErrReporter = nil }()
+
+	r := httptest.NewRequest("GET", "/", nil)
+	DefaultErrPage(httptest.NewRecorder(), r, guru.New(400, "oh noes"))
+	if len(reports) != 0 {
+		t.Fatalf("reported 4xx error: %v", reports)
+	}
+
+	err := errors.New("oh noes")
+	DefaultErrPage(httptest.NewRecorder(), r, err)
+	if len(reports) != 1 {
+		t.Fatalf("wrong number of reports: %d", len(reports))
+	}
+	if e := reports[0]; e.Err != err || e.Code != UserErrorCode(err) || e.Status != 500 || e.Request != r || e.Count != 1 {
+		t.Errorf("wrong report: %#v", e)
+	}
+}
@@ -0,0 +1,167 @@
+package zhttp
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"zgo.at/guru"
+	"zgo.at/json"
+	"zgo.at/zhttp/header"
+	"zgo.at/ztpl"
+)
+
+// Encoder writes data in a format for [Respond].
+//
+// The Content-Type header is already set when this is called, but the status
+// isn't: the encoder should write it with WriteHeader() only after checking
+// the data is valid, so that a returned error can still be sent as an error
+// page.
+type Encoder func(w http.ResponseWriter, r *http.Request, status int, data any) error
+
+type encoder struct {
+	mediaType string
+	enc       Encoder
+}
+
+var encoders = []encoder{
+	{"application/json", encodeJSON},
+}
+
+// Unlike JSON(), strings and []byte are always encoded rather than sent as-is,
+// as they're usually text and not JSON.
+func encodeJSON(w http.ResponseWriter, r *http.Request, status int, data any) error {
+	buf := new(bytes.Buffer)
+	enc := json.NewEncoder(buf)
+	enc.NullArray(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(data); err != nil {
+		return err
+	}
+	w.WriteHeader(status)
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+func encodeTemplate(name string) Encoder {
+	return func(w http.ResponseWriter, r *http.Request, status int, data any) error {
+		buf := new(bytes.Buffer)
+		if err := ztpl.Execute(buf, name, data); err != nil {
+			return err
+		}
+		w.WriteHeader(status)
+		_, err := buf.WriteTo(w)
+		return err
+	}
+}
+
+// RegisterEncoder registers an encoder for [Respond], replacing the existing
+// encoder if the media type is already registered. Encoders are offered in the
+// order they're registered; "application/json" is registered by default.
+//
+// This is not safe for concurrent use, and should be called on startup.
+func RegisterEncoder(mediaType string, enc Encoder) {
+	mediaType = strings.ToLower(mediaType)
+	for i := range encoders {
+		if encoders[i].mediaType == mediaType {
+			encoders[i].enc = enc
+			return
+		}
+	}
+	encoders = append(encoders, encoder{mediaType, enc})
+}
+
+// RespondOptions are options for [Respond].
+type RespondOptions struct {
+	// Template to render for text/html; HTML isn't offered if this is empty.
+	Template string
+
+	// Status code to use; default is 200.
+	Status int
+
+	// Media types to offer; the default is text/html (if Template is set) and
+	// all registered encoders.
+	Formats []string
+}
+
+// Respond sends data in the representation the client prefers, based on the
+// Accept header.
+//
+// HTML is rendered with [Template] if opts.Template is set, and other formats
+// use the encoder registered with [RegisterEncoder]. The JSON encoder always
+// encodes the data: unlike [JSON], a string is sent as a JSON string. If the client doesn't
+// accept any of the formats a 406 error is returned.
+//
+// The Vary header is set to Accept, and the Content-Type is set to the chosen
+// format (unless it's already set).
+func Respond(w http.ResponseWriter, r *http.Request, data any, opts RespondOptions) error {
+	offers := opts.Formats
+	if offers == nil {
+		offers = make([]string, 0, len(encoders)+1)
+		if opts.Template != "" {
+			offers = append(offers, "text/html")
+		}
+		for _, e := range encoders {
+			offers = append(offers, e.mediaType)
+		}
+	}
+
+	if !hasVary(w.Header(), "Accept") {
+		w.Header().Add("Vary", "Accept")
+	}
+	ct := header.Negotiate(header.ParseAccept(r.Header, "Accept"), offers...)
+	if ct == "" {
+		return guru.Errorf(http.StatusNotAcceptable, "not acceptable; available formats: %s",
+			strings.Join(offers, ", "))
+	}
+
+	var enc Encoder
+	if ct == "text/html" && opts.Template != "" {
+		enc = encodeTemplate(opts.Template)
+	} else {
+		for _, e := range encoders {
+			if e.mediaType == ct {
+				enc = e.enc
+				break
+			}
+		}
+	}
+	if enc == nil {
+		return fmt.Errorf("zhttp.Respond: no encoder for %q", ct)
+	}
+
+	status := opts.Status
+	if status == 0 {
+		status = 200
+	}
+	if strings.HasPrefix(ct, "text/") || ct == "application/json" {
+		ct += "; charset=utf-8"
+	}
+	setCT := w.Header().Get("Content-Type") == ""
+	if setCT {
+		w.Header().Set("Content-Type", ct)
+	}
+
+	ww, ok := w.(ResponseWriter)
+	if !ok {
+		ww = NewResponseWriter(w, r.ProtoMajor)
+	}
+	err := enc(ww, r, status, data)
+	// Don't use our Content-Type for the error page if nothing was written.
+	if err != nil && setCT && ww.Status() == 0 {
+		w.Header().Del("Content-Type")
+	}
+	return err
+}
+
+func hasVary(h http.Header, v string) bool {
+	for _, vary := range h.Values("Vary") {
+		for _, f := range strings.Split(vary, ",") {
+			if strings.EqualFold(strings.TrimSpace(f), v) {
+				return true
+			}
+		}
+	}
+	return false
+}
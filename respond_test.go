@@ -0,0 +1,96 @@
+package zhttp
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"zgo.at/guru"
+	"zgo.at/ztpl"
+)
+
+func TestRespond(t *testing.T) {
+	err := ztpl.Init(fstest.MapFS{"data.gohtml": {Data: []byte(`<p>{{.Name}}</p>`)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(e []encoder) { encoders = e }(slices.Clone(encoders))
+	RegisterEncoder("text/csv", func(w http.ResponseWriter, r *http.Request, status int, data any) error {
+		w.WriteHeader(status)
+		_, err := fmt.Fprintf(w, "name\n%s\n", data.(struct{ Name string }).Name)
+		return err
+	})
+
+	data := struct{ Name string }{"x"}
+	tests := []struct {
+		name, accept string
+		opts         RespondOptions
+		wantCode     int
+		wantCT       string
+		wantBody     string
+	}{
+		{"default", "", RespondOptions{Template: "data.gohtml"},
+			200, "text/html; charset=utf-8", "<p>x</p>"},
+		{"default without template", "", RespondOptions{},
+			200, "application/json; charset=utf-8", "{\n  \"Name\": \"x\"\n}"},
+		{"json", "application/json", RespondOptions{Template: "data.gohtml"},
+			200, "application/json; charset=utf-8", "{\n  \"Name\": \"x\"\n}"},
+		{"registered", "text/csv", RespondOptions{Template: "data.gohtml", Status: 201},
+			201, "text/csv; charset=utf-8", "name\nx"},
+		{"q-values", "text/html;q=0.1, text/csv;q=0.5", RespondOptions{Template: "data.gohtml"},
+			200, "text/csv; charset=utf-8", "name\nx"},
+		{"formats", "text/csv", RespondOptions{Formats: []string{"application/json"}},
+			406, "", ""},
+		{"html without template", "text/html", RespondOptions{},
+			406, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			r := httptest.NewRequest("GET", "/", nil)
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+
+			err := Respond(rr, r, data, tt.opts)
+			if rr.Header().Get("Vary") != "Accept" {
+				t.Errorf("wrong Vary: %q", rr.Header().Values("Vary"))
+			}
+			if tt.wantCode == 406 {
+				if guru.Code(err) != 406 {
+					t.Errorf("wrong error: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rr.Code != tt.wantCode {
+				t.Errorf("wrong code: %d", rr.Code)
+			}
+			if have := rr.Header().Get("Content-Type"); have != tt.wantCT {
+				t.Errorf("wrong Content-Type: %q", have)
+			}
+			if have := strings.TrimSpace(rr.Body.String()); have != tt.wantBody {
+				t.Errorf("\nhave: %q\nwant: %q", have, tt.wantBody)
+			}
+		})
+	}
+
+	t.Run("encoder error", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		err := Respond(rr, r, data, RespondOptions{Template: "missing.gohtml"})
+		if err == nil {
+			t.Fatal("err is nil")
+		}
+		if rr.Body.Len() > 0 || rr.Header().Get("Content-Type") != "" {
+			t.Errorf("wrote response: %q %q", rr.Header().Get("Content-Type"), rr.Body.String())
+		}
+	})
+}
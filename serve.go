@@ -2,19 +2,28 @@ package zhttp
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"log"
 	"log/slog"
 	"net"
 	"net/http"
+	"net/netip"
 	"os"
 	"os/exec"
 	"os/signal"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"golang.org/x/crypto/acme/autocert"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"zgo.at/zstd/znet"
 	"zgo.at/zstd/zstring"
 	"zgo.at/zstd/zsync"
 )
@@ -23,27 +32,159 @@ const (
 	ServeRedirect = uint8(0b0001)
 )
 
-type st struct{}
+// SignalAction is an action to take on a signal.
+type SignalAction uint8
 
-func (st) String() string { return "signalStop" }
-func (st) Signal()        {}
-
-var signalStop os.Signal = st{}
+// Signal actions for Server.Signals.
+const (
+	_              SignalAction = iota
+	SignalShutdown              // Gracefully shut down the server.
+	SignalReload                // Run the Server.Reload callbacks.
+	SignalUpgrade               // Zero-downtime upgrade; see Server.Signals.
+	SignalIgnore                // Ignore the signal.
+)
 
-// Serve a HTTP server with graceful shutdown and reasonable timeouts.
+// Server is a HTTP server with graceful shutdown and reasonable timeouts.
 //
-// The ReadHeader, Read, Write, or Idle timeouts are set to 10, 60, 60, and 120
-// seconds respectively if they are 0.
+// The ReadHeader, Read, Write, or Idle timeouts of the http.Server are set to
+// 10, 60, 60, and 120 seconds respectively if they are 0.
 //
 // Errors from the net/http package are logged via slog instead of the default
 // log package. "TLS handshake error" are silenced, since there's rarely
-// anything that can be done with that. Define server.ErrorLog if you want the
+// anything that can be done with that. Define Server.ErrorLog if you want the
 // old behaviour back.
 //
-// The server will use TLS if the http.Server has a valid TLSConfig, and will to
-// redirect port 80 to the TLS server if ServeRedirect is in flags, but will
-// fail gracefully with a warning to stderr if the permission for this is
-// denied.
+// The server will use TLS if the http.Server has a valid TLSConfig.
+//
+// The Addr of the http.Server can be a unix socket as "unix:/path/to/socket".
+// Stale socket files from a previous run are removed, and the socket is
+// removed on shutdown.
+type Server struct {
+	// HTTP server to run; this is required.
+	Server *http.Server
+
+	// Redirect RedirectPort to the TLS server. This will fail gracefully with
+	// a warning to stderr if the permission for this is denied.
+	//
+	// The redirect server uses the same timeouts and ErrorLog as Server, and
+	// is shut down together with it.
+	Redirect bool
+
+	// Port to listen on for the HTTP → HTTPS redirect; default is 80.
+	RedirectPort string
+
+	// Read the PROXY protocol header from connections from these CIDRs, for
+	// example "10.0.0.0/8". See [ProxyListener].
+	ProxyProtocol []string
+
+	// File mode and group for unix sockets; the defaults depend on the umask
+	// and primary group of the process. The group can be a name or numeric
+	// ID.
+	SocketMode  os.FileMode
+	SocketGroup string
+
+	// Drain deadline on shutdown: requests that are still running after this
+	// are cut off by force-closing the connections. The default of 0 waits
+	// until all requests are finished.
+	ShutdownTimeout time.Duration
+
+	// Additional listeners to serve on. Server.Addr isn't used if this is set
+	// and Server.Addr is empty.
+	//
+	// If this is empty and the process was started with systemd socket
+	// activation then the sockets from systemd are used, and Server.Addr is
+	// ignored. See [SystemdListeners]. A socket with FileDescriptorName=redirect
+	// is used for the redirect server.
+	Listeners []net.Listener
+
+	// Actions to take on signals. The default is to shut down on SIGTERM and
+	// SIGINT, and to reload on SIGHUP if there are any Reload callbacks or to
+	// shut down if there aren't.
+	//
+	// On SignalUpgrade the binary is started again with the same arguments,
+	// and the listening sockets are passed to the new process. This process
+	// will shut down once the new process reports it's ready to accept
+	// connections. If the new process fails to start the current process keeps
+	// serving. Note that the PID changes on upgrades, which may confuse process
+	// supervisors. Upgrades aren't supported if Listeners is set.
+	Signals map[os.Signal]SignalAction
+
+	// Callbacks to run on SignalReload, for example to reload templates or
+	// reopen log files. They're run in order, and the server keeps serving
+	// while they run. Errors are logged.
+	Reload []func() error
+
+	// Get certificates with ACME; see [NewACME]. The HTTP-01 challenges are
+	// answered on the redirect server.
+	//
+	// This sets GetCertificate on Server.TLSConfig if it's not set, or the
+	// TLSConfig if it's nil.
+	ACME *autocert.Manager
+
+	// Serve HTTP/2 without TLS ("h2c"), with both prior knowledge and the
+	// "Upgrade: h2c" header. This is useful behind a TLS-terminating proxy.
+	// This is ignored if the server uses TLS.
+	H2C bool
+
+	// HTTP/3 server to start next to the TCP server; see [HTTP3Server].
+	HTTP3 HTTP3Server
+
+	// Verify client certificates against these CAs (mutual TLS); see
+	// [LoadCertPool]. Use auth.ClientCert() to add the identity from the
+	// certificate to the request context.
+	//
+	// ClientAuth is the policy for client certificates; the default is
+	// tls.RequireAndVerifyClientCert if ClientCAs is set. This requires TLS.
+	ClientCAs  *x509.CertPool
+	ClientAuth tls.ClientAuthType
+
+	// Logger to use; uses slog.Default() if nil.
+	Logger *slog.Logger
+
+	// Called when the server is set up and ready to accept connections.
+	Ready func()
+
+	argv0, host, port string
+	listeners         []net.Listener
+	sig               chan os.Signal
+	signals           map[os.Signal]SignalAction
+	errCh             chan error
+	redirectSrv       *http.Server
+	redirectLn        net.Listener
+	inheritRedirect   net.Listener
+	inheritHTTP3      net.PacketConn
+	http3Conn         net.PacketConn
+	altSvc            string
+	proxyTrusted      []netip.Prefix
+	h2cHook           *http.Server
+	h2cMu             sync.Mutex
+	h2cConns          map[net.Conn]int // Running requests on h2c connections.
+	handler           http.Handler
+	connContext       func(context.Context, net.Conn) context.Context
+	protocols         *http.Protocols
+	upgradeReady      *os.File
+	ownedSocket       net.Listener // Unix socket we created, and should remove.
+	inflight          atomic.Int64
+}
+
+// HTTP3Server is a HTTP/3 (QUIC) server, such as *http3.Server from
+// github.com/quic-go/quic-go/http3.
+//
+// The Handler and TLSConfig need to be set on the HTTP/3 server; usually these
+// are the same as for the http.Server. Server listens on the UDP port with the
+// same address as the http.Server and calls Serve(), and advertises it with the
+// Alt-Svc header on responses from the TCP server. This requires TLS.
+type HTTP3Server interface {
+	Serve(net.PacketConn) error
+	Shutdown(context.Context) error
+	Close() error
+}
+
+// Serve a HTTP server with graceful shutdown and reasonable timeouts.
+//
+// This is a wrapper around [Server]; the only flag is ServeRedirect to redirect
+// port 80 to the TLS server. Errors after the server is started are logged and
+// shut down the server; use [Server.Run] if you want to handle them.
 //
 // The returned channel sends a value after the server is set up and ready to
 // accept connections, and another one after the server is shut down and stopped
@@ -66,18 +207,133 @@ var signalStop os.Signal = st{}
 //	time.Sleep(1 * time.Second)
 //	stop <- struct{}{}
 func Serve(flags uint8, stop <-chan struct{}, server *http.Server) (chan (struct{}), error) {
-	argv0, err := exec.LookPath(os.Args[0])
+	ch := make(chan struct{}, 1)
+	s := &Server{
+		Server:   server,
+		Redirect: flags&ServeRedirect != 0,
+		Ready:    func() { ch <- struct{}{} },
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-stop
+		cancel()
+	}()
+
+	err := s.start()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	go func() {
+		_ = s.wait(ctx)
+		ch <- struct{}{}
+		close(ch)
+	}()
+	return ch, nil
+}
+
+// Run the server, blocking until it's shut down.
+//
+// The server is shut down gracefully if the context is cancelled or on one of
+// the shutdown signals (see Server.Signals). If serving on any of the
+// listeners fails the server is also shut down, and the error is returned.
+func (s *Server) Run(ctx context.Context) error {
+	err := s.start()
+	if err != nil {
+		return err
+	}
+	return s.wait(ctx)
+}
+
+func (s *Server) log() *slog.Logger {
+	if s.Logger != nil {
+		return s.Logger
+	}
+	return slog.Default()
+}
+
+func (s *Server) start() (err error) {
+	if s.Server == nil {
+		return errors.New("zhttp.Server: Server is nil")
+	}
+	server := s.Server
+
+	// The Handler, ConnContext, and Protocols are wrapped or modified below;
+	// keep the originals so they can be restored on shutdown, and the
+	// http.Server can be run again.
+	s.handler, s.connContext, s.protocols = server.Handler, server.ConnContext, server.Protocols
+	s.listeners, s.inheritRedirect, s.inheritHTTP3, s.ownedSocket = nil, nil, nil, nil
+	s.redirectSrv, s.redirectLn, s.http3Conn = nil, nil, nil
+	defer func() {
+		if err != nil {
+			s.restore()
+			s.closeAll()
+		}
+	}()
+
+	s.argv0, err = exec.LookPath(os.Args[0])
 	if err != nil {
-		argv0 = os.Args[0]
+		s.argv0 = os.Args[0]
+	}
+
+	// Use the sockets from the parent process if we were started by an
+	// upgrade, or the sockets from systemd if we were started with socket
+	// activation. Only do this if no listeners were given.
+	//
+	// Always read the upgrade state, so that the parent gets told we're ready
+	// and it's not passed on to child processes.
+	inh, err := inheritedListeners()
+	if err != nil {
+		return fmt.Errorf("zhttp.Serve: %w", err)
+	}
+	if inh != nil {
+		s.upgradeReady = inh.ready
+		if len(s.Listeners) > 0 {
+			inh.ready = nil
+			inh.close()
+			inh = nil
+		}
+	}
+
+	s.listeners = append([]net.Listener{}, s.Listeners...)
+	listen := server.Addr != "" || len(s.listeners) == 0
+	if len(s.listeners) == 0 {
+		var inherit []net.Listener
+		if inh != nil {
+			inherit = inh.listeners
+			s.inheritRedirect, s.inheritHTTP3, s.ownedSocket = inh.redirect, inh.http3, inh.owned
+		}
+		if len(inherit) == 0 {
+			sd, names, err := systemdListeners()
+			if err != nil {
+				return fmt.Errorf("zhttp.Serve: %w", err)
+			}
+			for i, ln := range sd {
+				if names[i] == "redirect" && s.inheritRedirect == nil {
+					s.inheritRedirect = ln
+				} else {
+					inherit = append(inherit, ln)
+				}
+			}
+		}
+		if len(inherit) > 0 {
+			s.listeners, listen = inherit, false
+			server.Addr = inherit[0].Addr().String()
+		}
 	}
 
 	// Go uses ":80" to listen on all addresses, but also accept "*:80".
 	if strings.HasPrefix(server.Addr, "*:") {
 		server.Addr = server.Addr[1:]
 	}
-	host, port, err := net.SplitHostPort(server.Addr)
+	socket, isUnix := strings.CutPrefix(server.Addr, "unix:")
+	s.host, s.port, err = net.SplitHostPort(server.Addr)
 	if err != nil {
-		host, port = server.Addr, "443"
+		s.host, s.port = server.Addr, "443"
+	}
+	if isUnix {
+		s.host = ""
 	}
 
 	// Set some sane-ish defaults.
@@ -103,7 +359,7 @@ func Serve(flags uint8, stop <-chan struct{}, server *http.Server) (chan (struct
 		//   http: URL query contains semicolon, which is no longer a supported separator; parts of the query may be stripped when parsed; see golang.org/issue/25192
 		//
 		// This is people sending wrong data; not much we can do about that.
-		server.ErrorLog = LogWrap(
+		server.ErrorLog = logWrap(s.Logger,
 			"http: TLS handshake",
 			"http2: received GOAWAY",
 			"http2: server: error reading preface",
@@ -112,77 +368,533 @@ func Serve(flags uint8, stop <-chan struct{}, server *http.Server) (chan (struct
 			"write tcp ")
 	}
 
-	ln, err := net.Listen("tcp", server.Addr)
-	if err != nil {
-		if errors.Is(err, os.ErrPermission) {
-			fmt.Fprintf(os.Stderr, "\nPermission denied to bind to port %s; on Linux, try:\n", port)
-			fmt.Fprintln(os.Stderr, "    "+suCmd("setcap 'cap_net_bind_service=+ep' "+argv0))
+	if s.ACME != nil {
+		if server.TLSConfig == nil {
+			server.TLSConfig = s.ACME.TLSConfig()
+		} else if server.TLSConfig.GetCertificate == nil {
+			server.TLSConfig.GetCertificate = s.ACME.GetCertificate
 		}
-		return nil, fmt.Errorf("zhttp.Serve: %w", err)
 	}
-	// Set back the address; useful when using ":0" for a random port.
-	server.Addr = ln.Addr().String()
 
-	// Listen on signal to stop the server and gracefully shut the lot down.
-	ch := make(chan struct{}, 1)
-	go func() {
-		s := make(chan os.Signal, 1)
-		signal.Notify(s, syscall.SIGHUP, syscall.SIGTERM, os.Interrupt /*SIGINT*/)
-		go func() {
-			<-stop
-			s <- signalStop
-		}()
-		<-s
+	if s.ClientCAs != nil {
+		if server.TLSConfig == nil {
+			return errors.New("zhttp.Serve: ClientCAs requires TLS")
+		}
+		server.TLSConfig.ClientCAs = s.ClientCAs
+		server.TLSConfig.ClientAuth = s.ClientAuth
+		if server.TLSConfig.ClientAuth == tls.NoClientCert {
+			server.TLSConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
 
-		err := server.Shutdown(context.Background())
+	s.proxyTrusted = nil
+	if len(s.ProxyProtocol) > 0 {
+		s.proxyTrusted, err = parsePrefixes(s.ProxyProtocol)
 		if err != nil {
-			slog.Error(fmt.Sprintf("zhttp.Serve shutdown: %s", err))
+			return fmt.Errorf("zhttp.Serve: ProxyProtocol: %w", err)
 		}
-		ln.Close()
+		cc := s.connContext
+		server.ConnContext = func(ctx context.Context, c net.Conn) context.Context {
+			if cc != nil {
+				ctx = cc(ctx, c)
+			}
+			return ProxyConnContext(ctx, c)
+		}
+	}
 
-		signal.Stop(s)
-		ch <- struct{}{}
-		close(ch)
-	}()
+	if s.HTTP3 != nil && (isUnix || server.TLSConfig == nil) {
+		return errors.New("zhttp.Serve: HTTP3 requires TLS and a TCP address")
+	}
 
-	// Set up main server.
-	go func() {
-		var err error
-		if server.TLSConfig != nil {
-			err = server.ServeTLS(ln, "", "")
+	// Keep track of requests in flight, so we can report on it during
+	// shutdown.
+	h := s.handler
+	if h == nil {
+		h = http.DefaultServeMux
+	}
+	server.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.inflight.Add(1)
+		defer s.inflight.Add(-1)
+		if s.h2cHook != nil {
+			if c, ok := r.Context().Value(h2cConnKey{}).(net.Conn); ok {
+				s.trackH2C(c, 1)
+				defer s.trackH2C(c, -1)
+			}
+		}
+		if s.altSvc != "" {
+			w.Header().Set("Alt-Svc", s.altSvc)
+		}
+		h.ServeHTTP(w, r)
+	})
+	s.h2cHook = nil
+	if s.H2C && server.TLSConfig == nil {
+		s.setupH2C()
+	}
+
+	if listen && isUnix {
+		ln, err := listenUnix(socket, s.SocketMode, s.SocketGroup)
+		if err != nil {
+			return fmt.Errorf("zhttp.Serve: %w", err)
+		}
+		s.ownedSocket = ln
+		s.listeners = append([]net.Listener{ln}, s.listeners...)
+	} else if listen {
+		ln, err := net.Listen("tcp", server.Addr)
+		if err != nil {
+			if errors.Is(err, os.ErrPermission) {
+				fmt.Fprintf(os.Stderr, "\nPermission denied to bind to port %s; on Linux, try:\n", s.port)
+				fmt.Fprintln(os.Stderr, "    "+suCmd("setcap 'cap_net_bind_service=+ep' "+s.argv0))
+				fmt.Fprintln(os.Stderr, "Or use systemd socket activation.")
+			}
+			return fmt.Errorf("zhttp.Serve: %w", err)
+		}
+		// Set back the address; useful when using ":0" for a random port.
+		server.Addr = ln.Addr().String()
+		s.listeners = append([]net.Listener{ln}, s.listeners...)
+	}
+
+	s.http3Conn, s.altSvc = nil, ""
+	if s.HTTP3 != nil {
+		err := s.listenHTTP3()
+		if err != nil {
+			return err
+		}
+	} else if s.inheritHTTP3 != nil {
+		s.inheritHTTP3.Close()
+	}
+
+	s.redirectSrv, s.redirectLn = nil, nil
+	if !s.Redirect && s.inheritRedirect != nil {
+		s.inheritRedirect.Close()
+	}
+	if s.Redirect {
+		err := s.listenRedirect()
+		if err != nil {
+			return err
+		}
+	}
+	if s.ACME != nil {
+		if s.redirectSrv != nil {
+			h := s.ACME.HTTPHandler(s.redirectSrv.Handler)
+			s.redirectSrv.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// The Host is checked against the HostPolicy, which fails if
+				// there's a port in it.
+				if strings.HasPrefix(r.URL.Path, "/.well-known/acme-challenge/") {
+					r.Host = znet.RemovePort(r.Host)
+				}
+				h.ServeHTTP(w, r)
+			})
 		} else {
-			err = server.Serve(ln)
+			s.log().Warn("zhttp.Serve: ACME is enabled but there is no redirect server; can't answer HTTP-01 challenges")
 		}
-		if err != nil && err != http.ErrServerClosed {
-			slog.Error(fmt.Sprintf("zhttp.Serve: %s", err))
-			os.Exit(66)
+	}
+
+	s.errCh = make(chan error, len(s.listeners)+2)
+	s.sig = make(chan os.Signal, 1)
+	s.signals = s.Signals
+	if s.signals == nil {
+		hup := SignalShutdown
+		if len(s.Reload) > 0 {
+			hup = SignalReload
 		}
-	}()
+		s.signals = map[os.Signal]SignalAction{
+			syscall.SIGHUP:  hup,
+			syscall.SIGTERM: SignalShutdown,
+			os.Interrupt:    SignalShutdown, // SIGINT
+		}
+	}
+	for sig := range s.signals {
+		signal.Notify(s.sig, sig)
+	}
 
-	// Set up http → https redirect.
-	if flags&ServeRedirect != 0 {
+	// Set up main server.
+	for _, ln := range s.listeners {
+		if s.proxyTrusted != nil {
+			ln = &proxyListener{Listener: ln, trusted: s.proxyTrusted}
+		}
+		go func() {
+			var err error
+			if server.TLSConfig != nil {
+				err = server.ServeTLS(ln, "", "")
+			} else {
+				err = server.Serve(ln)
+			}
+			if err != nil && err != http.ErrServerClosed {
+				s.errCh <- fmt.Errorf("zhttp.Serve: %w", err)
+			}
+		}()
+	}
+
+	// Set up HTTP/3.
+	if s.http3Conn != nil {
 		go func() {
-			ctx := context.Background()
-			if server.BaseContext != nil {
-				ctx = server.BaseContext(nil)
+			err := s.HTTP3.Serve(s.http3Conn)
+			if err != nil && err != http.ErrServerClosed {
+				s.errCh <- fmt.Errorf("zhttp.Serve: http3: %w", err)
 			}
+		}()
+	}
 
-			err := http.ListenAndServe(host+":80", HandlerRedirectHTTP(ctx, port, server.Handler))
+	// Set up http → https redirect.
+	if s.redirectSrv != nil {
+		ln := s.redirectLn
+		if s.proxyTrusted != nil {
+			ln = &proxyListener{Listener: ln, trusted: s.proxyTrusted}
+		}
+		go func() {
+			err := s.redirectSrv.Serve(ln)
 			if err != nil && err != http.ErrServerClosed {
-				slog.Error(fmt.Sprintf("zhttp.Serve: ListenAndServe redirect 80: %s", err))
-				if errors.Is(err, os.ErrPermission) {
-					fmt.Fprintf(os.Stderr,
-						"\x1b[1mWARNING: No permission to bind to port 80, not setting up port 80 → %s redirect\x1b[0m\n",
-						port)
-					fmt.Fprintf(os.Stderr, "WARNING: On Linux, try:\n")
-					fmt.Fprintln(os.Stderr, "    "+suCmd("setcap 'cap_net_bind_service=+ep' "+argv0))
+				s.errCh <- fmt.Errorf("zhttp.Serve: redirect: %w", err)
+			}
+		}()
+	}
+
+	if s.Ready != nil {
+		s.Ready() // Ready to accept connections.
+	}
+	// Tell the parent process we're ready after an upgrade.
+	if s.upgradeReady != nil {
+		s.upgradeReady.Write([]byte{1})
+		s.upgradeReady.Close()
+		s.upgradeReady = nil
+	}
+	return nil
+}
+
+// Wait for a signal or the context to be cancelled and gracefully shut the lot
+// down.
+func (s *Server) wait(ctx context.Context) error {
+	// The upgrade runs in the background, as it may take a while for the new
+	// process to become ready; upgradeErr is nil if there's no upgrade in
+	// progress.
+	var (
+		serveErr                  error
+		upgradeErr                chan error
+		upgradeCtx, cancelUpgrade = context.WithCancel(ctx)
+	)
+	defer cancelUpgrade()
+loop:
+	for {
+		select {
+		case sig := <-s.sig:
+			switch s.signals[sig] {
+			case SignalIgnore:
+			case SignalReload:
+				s.reload(sig)
+			case SignalUpgrade:
+				if upgradeErr != nil {
+					s.log().Warn("zhttp.Serve: upgrade already in progress", "signal", sig.String())
+					continue
 				}
+				s.log().Info("zhttp.Serve: starting upgrade", "signal", sig.String())
+				ch := make(chan error, 1)
+				go func() { ch <- s.upgrade(upgradeCtx) }()
+				upgradeErr = ch
+			default:
+				break loop
 			}
+		case err := <-upgradeErr:
+			upgradeErr = nil
+			if err != nil {
+				s.log().Error(fmt.Sprintf("zhttp.Serve: upgrade: %s", err))
+				continue
+			}
+			s.log().Info("zhttp.Serve: upgrade ready; shutting down old process")
+			break loop
+		case <-ctx.Done():
+			break loop
+		case serveErr = <-s.errCh:
+			s.log().Error(serveErr.Error())
+			break loop
+		}
+	}
+	signal.Stop(s.sig)
+	if upgradeErr != nil { // Stop any upgrade that's still in progress.
+		cancelUpgrade()
+		<-upgradeErr
+	}
+
+	s.log().Info("zhttp.Serve: shutting down", "in_flight", s.inflight.Load())
+
+	shutCtx := context.Background()
+	if s.ShutdownTimeout > 0 {
+		var cancel context.CancelFunc
+		shutCtx, cancel = context.WithTimeout(shutCtx, s.ShutdownTimeout)
+		defer cancel()
+	}
+
+	// Report progress while draining, as it may take a while.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		t := time.NewTicker(5 * time.Second)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				s.log().Info("zhttp.Serve: waiting for requests to finish", "in_flight", s.inflight.Load())
+			}
+		}
+	}()
+
+	// Shut down all servers at the same time, so they all stop accepting new
+	// connections right away and share the drain deadline.
+	var (
+		wg                 sync.WaitGroup
+		err, rdrErr, h3Err error
+	)
+	if s.redirectSrv != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rdrErr = shutdown(shutCtx, s.redirectSrv.Shutdown, s.redirectSrv.Close)
+			if rdrErr != nil {
+				rdrErr = fmt.Errorf("zhttp.Serve shutdown redirect: %w", rdrErr)
+			}
+		}()
+	}
+	if s.http3Conn != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h3Err = shutdown(shutCtx, s.HTTP3.Shutdown, s.HTTP3.Close)
+			if h3Err != nil {
+				h3Err = fmt.Errorf("zhttp.Serve shutdown http3: %w", h3Err)
+			}
+			s.http3Conn.Close()
+		}()
+	}
+	if s.h2cHook != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.h2cHook.Shutdown(shutCtx)
 		}()
 	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err = shutdown(shutCtx, func(ctx context.Context) error {
+			err := s.Server.Shutdown(ctx)
+			if err == nil && s.h2cHook != nil {
+				err = s.waitH2C(ctx)
+			}
+			return err
+		}, func() error {
+			// Drain deadline passed: forcefully close anything that's left.
+			s.log().Warn("zhttp.Serve: drain deadline exceeded; closing remaining connections",
+				"deadline", s.ShutdownTimeout, "cut_off", s.inflight.Load())
+			err := s.Server.Close()
+			if s.h2cHook != nil {
+				s.closeH2C()
+			}
+			return err
+		})
+	}()
+	wg.Wait()
 
-	ch <- struct{}{} // Ready to accept connections.
-	return ch, nil
+	if err != nil {
+		s.log().Error(fmt.Sprintf("zhttp.Serve shutdown: %s", err))
+		err = fmt.Errorf("zhttp.Serve shutdown: %w", err)
+	} else {
+		s.log().Info("zhttp.Serve: shutdown complete")
+	}
+	for _, ln := range s.listeners {
+		ln.Close()
+	}
+	s.restore()
+	return errors.Join(serveErr, err, rdrErr, h3Err)
+}
+
+// Close all listeners and sockets if starting the server fails; this includes
+// any we got from systemd or the parent process.
+func (s *Server) closeAll() {
+	for _, ln := range s.listeners {
+		ln.Close()
+	}
+	if s.redirectLn != nil {
+		s.redirectLn.Close()
+	}
+	if s.inheritRedirect != nil {
+		s.inheritRedirect.Close()
+	}
+	if s.http3Conn != nil {
+		s.http3Conn.Close()
+	}
+	if s.inheritHTTP3 != nil {
+		s.inheritHTTP3.Close()
+	}
+	if s.upgradeReady != nil { // Tell the parent process we failed.
+		s.upgradeReady.Close()
+		s.upgradeReady = nil
+	}
+}
+
+// shutdown gracefully with shut, or forcefully with close once the context
+// deadline passes.
+func shutdown(ctx context.Context, shut func(context.Context) error, close func() error) error {
+	err := shut(ctx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		err = close()
+	}
+	return err
+}
+
+func (s *Server) restore() {
+	s.Server.Handler, s.Server.ConnContext, s.Server.Protocols = s.handler, s.connContext, s.protocols
+}
+
+func (s *Server) reload(sig os.Signal) {
+	s.log().Info("zhttp.Serve: reloading", "signal", sig.String())
+	for _, f := range s.Reload {
+		err := f()
+		if err != nil {
+			s.log().Error(fmt.Sprintf("zhttp.Serve: reload: %s", err))
+		}
+	}
+}
+
+// Listen on RedirectPort for the http → https redirect. This shares the
+// timeouts, ErrorLog, BaseContext, and ConnContext with the main server.
+func (s *Server) listenRedirect() error {
+	ctx := context.Background()
+	if s.Server.BaseContext != nil {
+		ctx = s.Server.BaseContext(nil)
+	}
+
+	rport := s.RedirectPort
+	if rport == "" {
+		rport = "80"
+	}
+	var (
+		ln  = s.inheritRedirect
+		err error
+	)
+	if ln == nil {
+		ln, err = net.Listen("tcp", net.JoinHostPort(s.host, rport))
+	}
+	if err != nil {
+		// Not being able to bind isn't fatal, as it's not uncommon to run
+		// without the permissions for this during development.
+		if errors.Is(err, os.ErrPermission) {
+			s.log().Error(fmt.Sprintf("zhttp.Serve: listen redirect %s: %s", rport, err))
+			fmt.Fprintf(os.Stderr,
+				"\x1b[1mWARNING: No permission to bind to port %s, not setting up port %[1]s → %s redirect\x1b[0m\n",
+				rport, s.port)
+			fmt.Fprintf(os.Stderr, "WARNING: On Linux, try:\n")
+			fmt.Fprintln(os.Stderr, "    "+suCmd("setcap 'cap_net_bind_service=+ep' "+s.argv0))
+			return nil
+		}
+		return fmt.Errorf("zhttp.Serve: listen redirect %s: %w", rport, err)
+	}
+
+	s.redirectLn = ln
+	s.redirectSrv = &http.Server{
+		Handler:           HandlerRedirectHTTP(ctx, s.port, s.Server.Handler),
+		ReadHeaderTimeout: s.Server.ReadHeaderTimeout,
+		ReadTimeout:       s.Server.ReadTimeout,
+		WriteTimeout:      s.Server.WriteTimeout,
+		IdleTimeout:       s.Server.IdleTimeout,
+		ErrorLog:          s.Server.ErrorLog,
+		BaseContext:       s.Server.BaseContext,
+		ConnContext:       s.Server.ConnContext,
+	}
+	return nil
+}
+
+func (s *Server) listenHTTP3() error {
+	pc := s.inheritHTTP3
+	if pc == nil {
+		var err error
+		pc, err = net.ListenPacket("udp", s.Server.Addr)
+		if err != nil {
+			return fmt.Errorf("zhttp.Serve: listen http3: %w", err)
+		}
+	}
+	_, port, err := net.SplitHostPort(pc.LocalAddr().String())
+	if err != nil {
+		pc.Close()
+		return fmt.Errorf("zhttp.Serve: listen http3: %w", err)
+	}
+	s.http3Conn = pc
+	s.altSvc = `h3=":` + port + `"; ma=2592000`
+	return nil
+}
+
+// Serve HTTP/2 without TLS. Connections with prior knowledge are handled by
+// net/http, and upgraded connections by x/net/http2/h2c.
+//
+// The h2c package hijacks the connection, so it's not tracked by Shutdown();
+// configure the http2.Server on a separate http.Server which is shut down
+// together with the main server, so it still gets a GOAWAY. The connections
+// with running requests are tracked, so they can be closed once the drain
+// deadline passes.
+func (s *Server) setupH2C() {
+	server := s.Server
+	s.h2cConns = make(map[net.Conn]int)
+	cc := server.ConnContext
+	server.ConnContext = func(ctx context.Context, c net.Conn) context.Context {
+		if cc != nil {
+			ctx = cc(ctx, c)
+		}
+		return context.WithValue(ctx, h2cConnKey{}, c)
+	}
+
+	p := new(http.Protocols)
+	if server.Protocols != nil {
+		*p = *server.Protocols
+	} else {
+		p.SetHTTP1(true)
+	}
+	p.SetUnencryptedHTTP2(true)
+	server.Protocols = p
+
+	h2s := &http2.Server{}
+	s.h2cHook = &http.Server{IdleTimeout: server.IdleTimeout}
+	_ = http2.ConfigureServer(s.h2cHook, h2s)
+
+	server.Handler = h2c.NewHandler(server.Handler, h2s)
+}
+
+type h2cConnKey struct{}
+
+func (s *Server) trackH2C(c net.Conn, n int) {
+	s.h2cMu.Lock()
+	defer s.h2cMu.Unlock()
+	s.h2cConns[c] += n
+	if s.h2cConns[c] <= 0 {
+		delete(s.h2cConns, c)
+	}
+}
+
+// Wait for requests on h2c connections to finish, closing the connections if
+// the context deadline passes.
+func (s *Server) waitH2C(ctx context.Context) error {
+	t := time.NewTicker(50 * time.Millisecond)
+	defer t.Stop()
+	for {
+		s.h2cMu.Lock()
+		n := len(s.h2cConns)
+		s.h2cMu.Unlock()
+		if n == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+func (s *Server) closeH2C() {
+	s.h2cMu.Lock()
+	defer s.h2cMu.Unlock()
+	for c := range s.h2cConns {
+		c.Close()
+	}
 }
 
 func suCmd(cmd string) string {
@@ -200,25 +912,35 @@ func suCmd(cmd string) string {
 
 // LogWrap returns a log.Logger which ignores any lines starting with prefixes.
 func LogWrap(prefixes ...string) *log.Logger {
+	return logWrap(nil, prefixes...)
+}
+
+// logWrap is like LogWrap, but logs to l. slog.Default() is used if l is nil;
+// this is looked up for every line, so slog.SetDefault() still works.
+func logWrap(l *slog.Logger, prefixes ...string) *log.Logger {
 	b := zsync.NewBuffer(nil)
 	ll := log.New(b, "", 0)
 
 	go func() {
 		for {
-			l, err := b.ReadString('\n')
+			line, err := b.ReadString('\n')
 			if err != nil {
-				if l != "" {
-					fmt.Print(l)
+				if line != "" {
+					fmt.Print(line)
 				}
 				time.Sleep(200 * time.Millisecond)
 				continue
 			}
 
-			if zstring.HasPrefixes(strings.TrimRight(l, "\n"), prefixes...) {
+			if zstring.HasPrefixes(strings.TrimRight(line, "\n"), prefixes...) {
 				continue
 			}
 
-			slog.Error(l)
+			if l == nil {
+				slog.Error(line)
+			} else {
+				l.Error(line)
+			}
 		}
 	}()
 
@@ -1,8 +1,24 @@
 package zhttp
 
 import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
 	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"zgo.at/zstd/zsync"
 )
 
 func TestServe(t *testing.T) {
@@ -16,3 +32,608 @@ func TestServe(t *testing.T) {
 	stop <- struct{}{}
 	<-ch
 }
+
+// startServer runs s until the test ends, returning once it's ready to serve.
+// Call stop to shut it down earlier; it returns the error from Run.
+func startServer(t *testing.T, s *Server) (stop func() error) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	ready := make(chan struct{})
+	s.Ready = func() { close(ready) }
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- s.Run(ctx) }()
+	select {
+	case <-ready:
+	case err := <-errCh:
+		cancel()
+		t.Fatal(err)
+	}
+
+	var (
+		once sync.Once
+		err  error
+	)
+	stop = func() error {
+		once.Do(func() {
+			cancel()
+			err = <-errCh
+		})
+		return err
+	}
+	t.Cleanup(func() {
+		if err := stop(); err != nil {
+			t.Error(err)
+		}
+	})
+	return stop
+}
+
+func TestServerRun(t *testing.T) {
+	s := Server{
+		Server: &http.Server{Addr: "127.0.0.1:0", Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("hello"))
+		})},
+		ShutdownTimeout: time.Second,
+	}
+	stop := startServer(t, &s)
+
+	resp, err := http.Get("http://" + s.Server.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(b) != "hello" {
+		t.Errorf("wrong body: %q", b)
+	}
+
+	if err := stop(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServerDrain(t *testing.T) {
+	var (
+		started = make(chan struct{})
+		buf     = zsync.NewBuffer(nil)
+	)
+	s := Server{
+		Server: &http.Server{Addr: "127.0.0.1:0", Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			time.Sleep(5 * time.Second) // Stuck long-poll.
+		})},
+		ShutdownTimeout: 100 * time.Millisecond,
+		Logger:          slog.New(slog.NewTextHandler(buf, nil)),
+	}
+	stop := startServer(t, &s)
+
+	go http.Get("http://" + s.Server.Addr)
+	<-started
+
+	start := time.Now()
+	if err := stop(); err != nil {
+		t.Fatal(err)
+	}
+	if took := time.Since(start); took > 2*time.Second {
+		t.Errorf("shutdown took %s", took)
+	}
+
+	out := buf.String()
+	for _, want := range []string{"in_flight=1", "cut_off=1"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("%q not in log:\n%s", want, out)
+		}
+	}
+}
+
+func TestServerRunError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln.Close() // Serving on a closed listener fails right away.
+
+	s := Server{
+		Server:    &http.Server{},
+		Listeners: []net.Listener{ln},
+		Logger:    slog.New(slog.DiscardHandler),
+	}
+	err = s.Run(context.Background())
+	if !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("wrong error: %v", err)
+	}
+}
+
+type countHandler struct{ n atomic.Int64 }
+
+func (h *countHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) { h.n.Add(1) }
+
+// The wrapped Handler, ConnContext, and Protocols should be restored after
+// shutdown or if starting fails, so they're not wrapped twice if Run is called
+// again.
+func TestServerRestore(t *testing.T) {
+	h := new(countHandler)
+	server := &http.Server{Addr: "127.0.0.1:0", Handler: h}
+	newServer := func() *Server {
+		return &Server{
+			Server:        server,
+			H2C:           true,
+			ProxyProtocol: []string{"10.0.0.0/8"},
+			Logger:        slog.New(slog.DiscardHandler),
+		}
+	}
+	checkRestored := func(t *testing.T) {
+		t.Helper()
+		if server.Handler != h || server.ConnContext != nil || server.Protocols != nil {
+			t.Fatalf("http.Server not restored: %#v", server)
+		}
+	}
+
+	stop := startServer(t, newServer())
+
+	resp, err := http.Get("http://" + server.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if n := h.n.Load(); n != 1 {
+		t.Errorf("handler called %d times", n)
+	}
+
+	if err := stop(); err != nil {
+		t.Fatal(err)
+	}
+	checkRestored(t)
+
+	// Fails to listen.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	server.Addr = ln.Addr().String()
+	if err := newServer().Run(context.Background()); err == nil {
+		t.Fatal("no error")
+	}
+	checkRestored(t)
+}
+
+func TestServerRedirect(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, rport, _ := net.SplitHostPort(ln.Addr().String())
+	ln.Close()
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+
+	// Run twice to make sure the redirect listener is closed.
+	for range 2 {
+		s := Server{
+			Server:       &http.Server{Addr: "127.0.0.1:0"},
+			Redirect:     true,
+			RedirectPort: rport,
+			Logger:       slog.New(slog.DiscardHandler),
+		}
+		stop := startServer(t, &s)
+
+		resp, err := client.Get("http://127.0.0.1:" + rport + "/path")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != 301 {
+			t.Errorf("wrong status: %d", resp.StatusCode)
+		}
+
+		if err := stop(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestServerReload(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ready := make(chan struct{})
+	reloaded := make(chan struct{})
+	s := Server{
+		Server: &http.Server{Addr: "127.0.0.1:0"},
+		Reload: []func() error{
+			func() error { return errors.New("oh noes") },
+			func() error { close(reloaded); return nil },
+		},
+		Logger: slog.New(slog.DiscardHandler),
+		Ready:  func() { close(ready) },
+	}
+
+	errCh := make(chan error)
+	go func() { errCh <- s.Run(ctx) }()
+	<-ready
+
+	s.sig <- syscall.SIGHUP
+	select {
+	case <-reloaded:
+	case err := <-errCh:
+		t.Fatalf("stopped on SIGHUP: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+
+	// Still serving.
+	resp, err := http.Get("http://" + s.Server.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	s.sig <- syscall.SIGTERM
+	if err := <-errCh; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServerH2C(t *testing.T) {
+	s := Server{
+		Server: &http.Server{Addr: "127.0.0.1:0", Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(r.Proto))
+		})},
+		H2C:    true,
+		Logger: slog.New(slog.DiscardHandler),
+	}
+	startServer(t, &s)
+
+	t.Run("prior knowledge", func(t *testing.T) {
+		client := &http.Client{Transport: &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, network, addr)
+			},
+		}}
+		resp, err := client.Get("http://" + s.Server.Addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(b) != "HTTP/2.0" {
+			t.Errorf("wrong proto: %q", b)
+		}
+	})
+
+	t.Run("upgrade", func(t *testing.T) {
+		c, err := net.Dial("tcp", s.Server.Addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		io.WriteString(c, "GET / HTTP/1.1\r\nHost: localhost\r\n"+
+			"Connection: Upgrade, HTTP2-Settings\r\nUpgrade: h2c\r\nHTTP2-Settings: AAMAAABkAARAAAAAAAIAAAAA\r\n\r\n")
+		line, err := bufio.NewReader(c).ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "HTTP/1.1 101 Switching Protocols\r\n"; line != want {
+			t.Errorf("\nhave: %q\nwant: %q", line, want)
+		}
+	})
+
+	t.Run("http1", func(t *testing.T) {
+		resp, err := http.Get("http://" + s.Server.Addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(b) != "HTTP/1.1" {
+			t.Errorf("wrong proto: %q", b)
+		}
+	})
+}
+
+// Requests on upgraded h2c connections should be cut off after the drain
+// deadline.
+func TestServerH2CDrain(t *testing.T) {
+	var (
+		started = make(chan struct{})
+		cutOff  = make(chan struct{})
+		buf     = zsync.NewBuffer(nil)
+	)
+	s := Server{
+		Server: &http.Server{Addr: "127.0.0.1:0", Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			select { // Stuck long-poll.
+			case <-r.Context().Done():
+				close(cutOff)
+			case <-time.After(5 * time.Second):
+			}
+		})},
+		H2C:             true,
+		ShutdownTimeout: 100 * time.Millisecond,
+		Logger:          slog.New(slog.NewTextHandler(buf, nil)),
+	}
+	stop := startServer(t, &s)
+
+	c, err := net.Dial("tcp", s.Server.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	io.WriteString(c, "GET / HTTP/1.1\r\nHost: localhost\r\n"+
+		"Connection: Upgrade, HTTP2-Settings\r\nUpgrade: h2c\r\nHTTP2-Settings: AAMAAABkAARAAAAAAAIAAAAA\r\n\r\n")
+	io.WriteString(c, http2.ClientPreface+"\x00\x00\x00\x04\x00\x00\x00\x00\x00") // Empty SETTINGS frame.
+	<-started
+
+	start := time.Now()
+	if err := stop(); err != nil {
+		t.Fatal(err)
+	}
+	if took := time.Since(start); took > 2*time.Second {
+		t.Errorf("shutdown took %s", took)
+	}
+	select {
+	case <-cutOff:
+	case <-time.After(time.Second):
+		t.Error("request not cut off")
+	}
+	if out := buf.String(); !strings.Contains(out, "cut_off=1") {
+		t.Errorf("cut_off=1 not in log:\n%s", out)
+	}
+}
+
+type fakeHTTP3 struct {
+	conn     chan net.PacketConn
+	shutdown chan struct{}
+	slow     bool // Shutdown waits until the deadline, like a stuck request.
+}
+
+func (f *fakeHTTP3) Serve(c net.PacketConn) error {
+	f.conn <- c
+	<-f.shutdown
+	return http.ErrServerClosed
+}
+func (f *fakeHTTP3) Shutdown(ctx context.Context) error {
+	if f.slow {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	close(f.shutdown)
+	return nil
+}
+func (f *fakeHTTP3) Close() error {
+	if f.slow {
+		close(f.shutdown)
+	}
+	return nil
+}
+
+func TestServerHTTP3(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := genCert(t, dir, "localhost", nil, x509.Certificate{DNSNames: []string{"localhost"}})
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("requires TLS", func(t *testing.T) {
+		s := Server{
+			Server: &http.Server{Addr: "127.0.0.1:0"},
+			HTTP3:  &fakeHTTP3{},
+			Logger: slog.New(slog.DiscardHandler),
+		}
+		err := s.Run(context.Background())
+		if err == nil || !strings.Contains(err.Error(), "requires TLS") {
+			t.Errorf("wrong error: %v", err)
+		}
+	})
+
+	h3 := &fakeHTTP3{conn: make(chan net.PacketConn, 1), shutdown: make(chan struct{})}
+	s := Server{
+		Server: &http.Server{
+			Addr:      "127.0.0.1:0",
+			TLSConfig: &tls.Config{Certificates: []tls.Certificate{cert}},
+		},
+		HTTP3:  h3,
+		Logger: slog.New(slog.DiscardHandler),
+	}
+	stop := startServer(t, &s)
+
+	pc := <-h3.conn
+	if have, want := pc.LocalAddr().String(), s.Server.Addr; have != want {
+		t.Errorf("wrong UDP address\nhave: %s\nwant: %s", have, want)
+	}
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	resp, err := client.Get("https://" + s.Server.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	_, port, _ := net.SplitHostPort(s.Server.Addr)
+	if have, want := resp.Header.Get("Alt-Svc"), `h3=":`+port+`"; ma=2592000`; have != want {
+		t.Errorf("wrong Alt-Svc\nhave: %s\nwant: %s", have, want)
+	}
+
+	if err := stop(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-h3.shutdown:
+	default:
+		t.Error("HTTP/3 server not shut down")
+	}
+}
+
+// A slow HTTP/3 shutdown shouldn't keep the TCP server accepting connections.
+func TestServerShutdownConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := genCert(t, dir, "localhost", nil, x509.Certificate{DNSNames: []string{"localhost"}})
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h3 := &fakeHTTP3{conn: make(chan net.PacketConn, 1), shutdown: make(chan struct{}), slow: true}
+	s := Server{
+		Server: &http.Server{
+			Addr:      "127.0.0.1:0",
+			TLSConfig: &tls.Config{Certificates: []tls.Certificate{cert}},
+		},
+		HTTP3:           h3,
+		ShutdownTimeout: 500 * time.Millisecond,
+		Logger:          slog.New(slog.DiscardHandler),
+	}
+	stop := startServer(t, &s)
+	<-h3.conn
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- stop() }()
+	time.Sleep(100 * time.Millisecond)
+	if c, err := net.Dial("tcp", s.Server.Addr); err == nil {
+		c.Close()
+		t.Error("TCP server still accepting connections")
+	}
+	if err := <-errCh; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Everything should be closed if starting fails.
+func TestServerStartCleanup(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := genCert(t, dir, "localhost", nil, x509.Certificate{DNSNames: []string{"localhost"}})
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rln.Close()
+	_, rport, _ := net.SplitHostPort(rln.Addr().String())
+
+	s := Server{
+		Server: &http.Server{
+			Addr:      "127.0.0.1:0",
+			TLSConfig: &tls.Config{Certificates: []tls.Certificate{cert}},
+		},
+		HTTP3:        &fakeHTTP3{},
+		Redirect:     true,
+		RedirectPort: rport, // In use.
+		Logger:       slog.New(slog.DiscardHandler),
+	}
+	err = s.Run(context.Background())
+	if err == nil {
+		t.Fatal("no error")
+	}
+
+	ln, err := net.Listen("tcp", s.Server.Addr)
+	if err != nil {
+		t.Fatalf("TCP listener not closed: %s", err)
+	}
+	ln.Close()
+	pc, err := net.ListenPacket("udp", s.Server.Addr)
+	if err != nil {
+		t.Fatalf("HTTP/3 socket not closed: %s", err)
+	}
+	pc.Close()
+}
+
+func TestServerClientCAs(t *testing.T) {
+	dir := t.TempDir()
+	srvCert, srvKey := genCert(t, dir, "localhost", nil, x509.Certificate{DNSNames: []string{"localhost"}})
+	caCert, caKey := genCert(t, dir, "ca", nil, x509.Certificate{
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	})
+	ca, err := tls.LoadX509KeyPair(caCert, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clCert, clKey := genCert(t, dir, "client", &ca, x509.Certificate{
+		DNSNames:    []string{"client.internal"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	otherCert, otherKey := genCert(t, dir, "other", nil, x509.Certificate{
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+
+	pool, err := LoadCertPool(caCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := tls.LoadX509KeyPair(srvCert, srvKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := Server{
+		Server: &http.Server{
+			Addr:      "127.0.0.1:0",
+			TLSConfig: &tls.Config{Certificates: []tls.Certificate{cert}},
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(r.TLS.VerifiedChains[0][0].DNSNames[0]))
+			}),
+		},
+		ClientCAs: pool,
+		Logger:    slog.New(slog.DiscardHandler),
+	}
+	startServer(t, &s)
+
+	get := func(certFile, keyFile string) (string, error) {
+		conf := &tls.Config{InsecureSkipVerify: true}
+		if certFile != "" {
+			c, err := tls.LoadX509KeyPair(certFile, keyFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			conf.Certificates = []tls.Certificate{c}
+		}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: conf}}
+		resp, err := client.Get("https://" + s.Server.Addr)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		return string(b), err
+	}
+
+	if have, err := get(clCert, clKey); err != nil || have != "client.internal" {
+		t.Errorf("valid certificate: %q; %v", have, err)
+	}
+	if _, err := get("", ""); err == nil {
+		t.Error("no error without certificate")
+	}
+	if _, err := get(otherCert, otherKey); err == nil {
+		t.Error("no error with untrusted certificate")
+	}
+}
+
+func TestLogWrap(t *testing.T) {
+	l := LogWrap("ignore")
+
+	// Default logger is looked up when logging, not when creating the logger.
+	buf := zsync.NewBuffer(nil)
+	defer func(l *slog.Logger) { slog.SetDefault(l) }(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(buf, nil)))
+
+	l.Print("ignore this")
+	l.Print("log this")
+	for range 50 {
+		if strings.Contains(buf.String(), "log this") {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "log this") || strings.Contains(out, "ignore this") {
+		t.Errorf("wrong output: %q", out)
+	}
+}
@@ -0,0 +1,173 @@
+package zhttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"zgo.at/json"
+)
+
+// EventStream is a stream of Server-Sent Events; use [SSE] to create one.
+type EventStream struct {
+	// ID of the last event the client received, from the Last-Event-ID
+	// header. This is set when the client reconnects.
+	LastEventID string
+
+	w      http.ResponseWriter
+	rc     *http.ResponseController
+	ctx    context.Context
+	mu     sync.Mutex
+	closed bool
+}
+
+// SSE starts a stream of Server-Sent Events.
+//
+// This sends the headers and status code, and disables the write timeout for
+// the request. The stream stops when the request context is cancelled; all
+// methods will return the context error after that. Call Close() when the
+// handler returns to stop any heartbeats:
+//
+//	es, err := zhttp.SSE(w, r)
+//	if err != nil {
+//	    return err
+//	}
+//	defer es.Close()
+//	es.Heartbeat(15 * time.Second)
+//
+//	for {
+//	    select {
+//	    case <-es.Done():
+//	        return nil
+//	    case ev := <-events:
+//	        err := es.Send("update", ev.ID, ev)
+//	        if err != nil {
+//	            return err
+//	        }
+//	    }
+//	}
+//
+// The ResponseWriter must support flushing; the wrappers from
+// [NewResponseWriter] work, and the bytes written are counted as usual.
+func SSE(w http.ResponseWriter, r *http.Request) (*EventStream, error) {
+	es := &EventStream{
+		LastEventID: r.Header.Get("Last-Event-ID"),
+		w:           w,
+		rc:          http.NewResponseController(w),
+		ctx:         r.Context(),
+	}
+
+	// Long-lived connection, so the server's WriteTimeout doesn't make sense.
+	err := es.rc.SetWriteDeadline(time.Time{})
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return nil, fmt.Errorf("zhttp.SSE: %w", err)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // Don't buffer in nginx.
+	writeStatus(w, 200, "")
+	if err := es.rc.Flush(); err != nil {
+		return nil, fmt.Errorf("zhttp.SSE: %w", err)
+	}
+	return es, nil
+}
+
+// Done is closed when the client disconnects.
+func (es *EventStream) Done() <-chan struct{} { return es.ctx.Done() }
+
+// Close the stream, stopping any heartbeats. This doesn't close the
+// connection, which is closed when the handler returns.
+func (es *EventStream) Close() {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	es.closed = true
+}
+
+// Send an event.
+//
+// The event and id are optional. The data is sent as-is if it's a string or
+// []byte, or encoded as JSON otherwise.
+func (es *EventStream) Send(event, id string, data any) error {
+	var d string
+	switch dd := data.(type) {
+	case string:
+		d = dd
+	case []byte:
+		d = string(dd)
+	default:
+		j, err := json.Marshal(data)
+		if err != nil {
+			return fmt.Errorf("zhttp.EventStream.Send: %w", err)
+		}
+		d = string(j)
+	}
+
+	var b strings.Builder
+	if event != "" {
+		b.WriteString("event: " + sseLine(event) + "\n")
+	}
+	if id != "" {
+		b.WriteString("id: " + sseLine(id) + "\n")
+	}
+	// CRLF, CR, and LF are all line endings in SSE; a lone CR would otherwise
+	// allow injecting fields.
+	d = strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(d)
+	for _, line := range strings.Split(d, "\n") {
+		b.WriteString("data: " + line + "\n")
+	}
+	b.WriteString("\n")
+	return es.write(b.String())
+}
+
+// Retry tells the client how long to wait before reconnecting.
+func (es *EventStream) Retry(d time.Duration) error {
+	return es.write("retry: " + strconv.FormatInt(d.Milliseconds(), 10) + "\n\n")
+}
+
+// Heartbeat sends a comment every interval in the background, to keep the
+// connection alive through proxies. This stops when the stream is closed or the
+// client disconnects.
+func (es *EventStream) Heartbeat(interval time.Duration) {
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-es.ctx.Done():
+				return
+			case <-t.C:
+				if es.write(":\n\n") != nil {
+					return
+				}
+			}
+		}
+	}()
+}
+
+func (es *EventStream) write(s string) error {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	if es.closed {
+		return errors.New("zhttp.EventStream: stream is closed")
+	}
+	if err := es.ctx.Err(); err != nil {
+		return err
+	}
+
+	_, err := es.w.Write([]byte(s))
+	if err != nil {
+		return err
+	}
+	return es.rc.Flush()
+}
+
+// Event names and IDs can't contain newlines.
+func sseLine(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
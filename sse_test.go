@@ -0,0 +1,88 @@
+package zhttp
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSSE(t *testing.T) {
+	var (
+		written = make(chan int, 1)
+		done    = make(chan error, 1)
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ww := NewResponseWriter(w, r.ProtoMajor)
+		defer func() { written <- ww.BytesWritten() }()
+
+		es, err := SSE(ww, r)
+		if err != nil {
+			done <- err
+			return
+		}
+		defer es.Close()
+
+		es.Retry(3 * time.Second)
+		es.Send("", "", "last: "+es.LastEventID)
+		es.Send("update", "2", map[string]int{"n": 2})
+		es.Send("multi", "", "line 1\nline 2")
+		es.Send("cr", "", "x\rid: evil\r\ny")
+		es.Heartbeat(10 * time.Millisecond)
+
+		<-es.Done()
+		done <- es.Send("", "", "after close")
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r, _ := http.NewRequestWithContext(ctx, "GET", srv.URL, nil)
+	r.Header.Set("Last-Event-ID", "1")
+	resp, err := http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("wrong Content-Type: %q", ct)
+	}
+
+	want := "retry: 3000\n\n" +
+		"data: last: 1\n\n" +
+		"event: update\nid: 2\ndata: {\"n\":2}\n\n" +
+		"event: multi\ndata: line 1\ndata: line 2\n\n" +
+		"event: cr\ndata: x\ndata: id: evil\ndata: y\n\n" +
+		":\n\n"
+	var (
+		have strings.Builder
+		br   = bufio.NewReader(resp.Body)
+	)
+	for have.Len() < len(want) {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		have.WriteString(line)
+	}
+	if have.String() != want {
+		t.Errorf("\nhave: %q\nwant: %q", have.String(), want)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("no error from Send after context is cancelled")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("stream not stopped after cancel")
+	}
+	if n := <-written; n < len(want) {
+		t.Errorf("BytesWritten too low: %d", n)
+	}
+}
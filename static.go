@@ -1,13 +1,18 @@
 package zhttp
 
 import (
+	"bytes"
 	"fmt"
+	"hash/fnv"
+	"io"
 	"io/fs"
 	"mime"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 )
 
 // Static file server.
@@ -16,6 +21,7 @@ type Static struct {
 	cacheControl map[string]int
 	headers      map[string]map[string]string // Headers for specific URLs
 	files        fs.FS
+	etags        *sync.Map // ETags for files without a modtime, by path.
 }
 
 // Constants for the NewStatic() cache parameter.
@@ -42,6 +48,10 @@ const (
 // cache mapping. The path is matched with filepath.Match() and the key "" is
 // used if nothing matches. There is no guarantee about the order if multiple
 // keys match. One of special Cache* constants can be used.
+//
+// Range and conditional requests are supported. The ETag is set from the
+// modification time and size, or a hash of the contents for files without a
+// modification time (such as embed.FS).
 func NewStatic(domain string, files fs.FS, cache map[string]int) Static {
 	for k := range cache {
 		_, err := filepath.Match(k, "")
@@ -50,7 +60,7 @@ func NewStatic(domain string, files fs.FS, cache map[string]int) Static {
 		}
 	}
 
-	return Static{domain: domain, cacheControl: cache, files: files, headers: make(map[string]map[string]string)}
+	return Static{domain: domain, cacheControl: cache, files: files, headers: make(map[string]map[string]string), etags: new(sync.Map)}
 }
 
 var Static404 = func(w http.ResponseWriter, r *http.Request) {
@@ -72,7 +82,7 @@ func (s Static) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if path == "" {
 		path = "index.html"
 	}
-	d, err := fs.ReadFile(s.files, path)
+	fp, err := s.files.Open(path)
 	if err != nil {
 		if os.IsNotExist(err) {
 			Static404(w, r)
@@ -81,6 +91,25 @@ func (s Static) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), 500)
 		return
 	}
+	defer fp.Close()
+	st, err := fp.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	if st.IsDir() {
+		Static404(w, r)
+		return
+	}
+	rs, ok := fp.(io.ReadSeeker)
+	if !ok {
+		d, err := io.ReadAll(fp)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		rs = bytes.NewReader(d)
+	}
 
 	ct := mime.TypeByExtension(filepath.Ext(path))
 	if ct == "" {
@@ -138,6 +167,40 @@ func (s Static) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	w.WriteHeader(200)
-	w.Write(d)
+	var etag string
+	if w.Header().Get("Etag") == "" {
+		etag, err = s.etag(path, st, rs)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+	}
+	StreamContent(w, r, path, st.ModTime(), etag, rs)
+}
+
+// Get the ETag from the modtime and size, or from a hash of the contents if
+// there is no modtime (e.g. for embed.FS). Files without a modtime can't
+// change, so the hash is only calculated once.
+func (s Static) etag(path string, st fs.FileInfo, rs io.ReadSeeker) (string, error) {
+	if !st.ModTime().IsZero() {
+		return strconv.FormatInt(st.ModTime().UnixNano(), 36) + "-" + strconv.FormatInt(st.Size(), 36), nil
+	}
+	if s.etags != nil {
+		if e, ok := s.etags.Load(path); ok {
+			return e.(string), nil
+		}
+	}
+
+	h := fnv.New64a()
+	if _, err := io.Copy(h, rs); err != nil {
+		return "", err
+	}
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	etag := strconv.FormatUint(h.Sum64(), 36)
+	if s.etags != nil {
+		s.etags.Store(path, etag)
+	}
+	return etag, nil
 }
@@ -1,11 +1,13 @@
 package zhttp
 
 import (
+	"fmt"
 	"mime"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"reflect"
+	"strconv"
 	"testing"
 	"testing/fstest"
 
@@ -140,3 +142,43 @@ func TestStatic(t *testing.T) {
 		})
 	}
 }
+
+func TestStaticRange(t *testing.T) {
+	s := NewStatic("", fstest.MapFS{"a.txt": {Data: []byte("0123456789")}}, nil)
+
+	r := httptest.NewRequest("GET", "/a.txt", nil)
+	r.Header.Set("Range", "bytes=2-4")
+	rr := httptest.NewRecorder()
+	s.ServeHTTP(rr, r)
+	ztest.Code(t, rr, 206)
+	if have := rr.Body.String(); have != "234" {
+		t.Errorf("wrong body: %q", have)
+	}
+
+	etag := rr.Header().Get("Etag")
+	if etag == "" {
+		t.Fatal("no Etag")
+	}
+	r = httptest.NewRequest("GET", "/a.txt", nil)
+	r.Header.Set("If-None-Match", etag)
+	rr = httptest.NewRecorder()
+	s.ServeHTTP(rr, r)
+	ztest.Code(t, rr, 304)
+
+	// Files with a modtime use that for the ETag.
+	s = NewStatic("", os.DirFS("."), nil)
+	rr = httptest.NewRecorder()
+	s.ServeHTTP(rr, httptest.NewRequest("GET", "/static_test.go", nil))
+	ztest.Code(t, rr, 200)
+	st, err := os.Stat("static_test.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := fmt.Sprintf(`"%s-%s"`, strconv.FormatInt(st.ModTime().UnixNano(), 36), strconv.FormatInt(st.Size(), 36))
+	if have := rr.Header().Get("Etag"); have != want {
+		t.Errorf("wrong Etag\nhave: %s\nwant: %s", have, want)
+	}
+	if rr.Header().Get("Last-Modified") == "" {
+		t.Error("no Last-Modified")
+	}
+}
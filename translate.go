@@ -0,0 +1,107 @@
+package zhttp
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"zgo.at/zhttp/ctxkey"
+	"zgo.at/zhttp/header"
+)
+
+// Translator translates messages.
+//
+// The built-in messages from [UserErrorContext], [ErrorDecode], the CSRF
+// checks in the auth package, and flash messages are translated with it.
+// Messages are identified by the English text, which can be a fmt format
+// string.
+type Translator interface {
+	// Languages gets the supported languages as BCP 47 tags (e.g. "en",
+	// "pt-BR"). The first language is the default.
+	Languages() []string
+
+	// Translate a message to the language, formatting it with args if there
+	// are any; messages without args shouldn't be formatted. Return the
+	// message as-is if there is no translation.
+	Translate(lang, msg string, args ...any) string
+}
+
+type language struct {
+	lang string
+	t    Translator
+}
+
+// WithTranslator chooses the language from the Accept-Language header and adds
+// it to the request context, for use with [T] and [GetLanguage].
+func WithTranslator(t Translator) func(http.Handler) http.Handler {
+	langs := t.Languages()
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Language")
+			lang := header.NegotiateLanguage(header.ParseAccept(r.Header, "Accept-Language"), langs...)
+			ctx := context.WithValue(r.Context(), ctxkey.Language, &language{lang: lang, t: t})
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// GetLanguage gets the language set by [WithTranslator], or "" if there is
+// none.
+func GetLanguage(ctx context.Context) string {
+	if l, ok := ctx.Value(ctxkey.Language).(*language); ok {
+		return l.lang
+	}
+	return ""
+}
+
+// T translates the message with the Translator set by [WithTranslator].
+//
+// The message is formatted with args as-is if there is no Translator.
+func T(ctx context.Context, msg string, args ...any) string {
+	if l, ok := ctx.Value(ctxkey.Language).(*language); ok {
+		return l.t.Translate(l.lang, msg, args...)
+	}
+	if len(args) == 0 {
+		return msg
+	}
+	return fmt.Sprintf(msg, args...)
+}
+
+// translate a message without formatting it.
+func translate(ctx context.Context, msg string) string {
+	if l, ok := ctx.Value(ctxkey.Language).(*language); ok {
+		return l.t.Translate(l.lang, msg)
+	}
+	return msg
+}
+
+// translatable is implemented by errors with a built-in user-facing message.
+type translatable interface {
+	error
+	translate(context.Context) string
+}
+
+// userMsg is a built-in user-facing error message.
+type userMsg struct {
+	msg  string
+	args []any
+}
+
+func newUserMsg(msg string, args ...any) error { return &userMsg{msg: msg, args: args} }
+
+func (m *userMsg) Error() string {
+	if len(m.args) == 0 {
+		return m.msg
+	}
+	return fmt.Sprintf(m.msg, m.args...)
+}
+func (m *userMsg) translate(ctx context.Context) string { return T(ctx, m.msg, m.args...) }
+
+// translatedErr is a translated translatable error.
+type translatedErr struct {
+	error
+	msg string
+}
+
+func (e *translatedErr) Error() string { return e.msg }
+func (e *translatedErr) Unwrap() error { return e.error }
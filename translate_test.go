@@ -0,0 +1,95 @@
+package zhttp
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type testTranslator map[string]string
+
+func (testTranslator) Languages() []string { return []string{"en", "nl"} }
+func (t testTranslator) Translate(lang, msg string, args ...any) string {
+	if tr, ok := t[msg]; ok && lang == "nl" {
+		msg = tr
+	}
+	if len(args) == 0 {
+		return msg
+	}
+	return fmt.Sprintf(msg, args...)
+}
+
+func TestTranslate(t *testing.T) {
+	tr := testTranslator{
+		"not found":        "niet gevonden",
+		"invalid JSON: %s": "ongeldige JSON: %s",
+		"unexpected error code ‘%s’; this has been reported for investigation": "onverwachte foutcode ‘%s’",
+		"Saved": "Opgeslagen",
+	}
+
+	tests := []struct {
+		lang string
+		err  error
+		want string
+	}{
+		{"", sql.ErrNoRows, "Error 404: not found"},
+		{"nl", sql.ErrNoRows, "Error 404: niet gevonden"},
+		{"nl-BE, en;q=0.5", sql.ErrNoRows, "Error 404: niet gevonden"},
+		{"de", sql.ErrNoRows, "Error 404: not found"},
+		{"nl", &ErrorDecode{ct: ContentJSON, err: errors.New("unexpected EOF")}, "Error 400: ongeldige JSON: unexpected EOF"},
+		{"nl", errors.New("oh noes"), "Error 500: onverwachte foutcode ‘" + UserErrorCode(errors.New("oh noes")) + "’"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.lang, func(t *testing.T) {
+			var lang string
+			h := WithTranslator(tr)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				lang = GetLanguage(r.Context())
+				DefaultErrPage(w, r, tt.err)
+			}))
+
+			r := httptest.NewRequest("GET", "/", nil)
+			r.Header.Set("Accept", "text/plain")
+			if tt.lang != "" {
+				r.Header.Set("Accept-Language", tt.lang)
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, r)
+
+			if have := rr.Body.String(); have != tt.want {
+				t.Errorf("\nhave: %s\nwant: %s", have, tt.want)
+			}
+			if want := map[bool]string{true: "nl", false: "en"}[strings.HasPrefix(tt.lang, "nl")]; lang != want {
+				t.Errorf("wrong language: %q", lang)
+			}
+			if v := rr.Header().Get("Vary"); v != "Accept-Language" {
+				t.Errorf("wrong Vary: %q", v)
+			}
+		})
+	}
+
+	t.Run("flash", func(t *testing.T) {
+		h := WithTranslator(tr)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Flash(w, r, "Saved")
+			fmt.Fprint(w, ReadFlash(w, r).Message)
+		}))
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept-Language", "nl")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, r)
+		if have := rr.Body.String(); have != "Opgeslagen" {
+			t.Errorf("wrong flash: %q", have)
+		}
+	})
+
+	t.Run("no translator", func(t *testing.T) {
+		if have := T(context.Background(), "Saved %d items", 5); have != "Saved 5 items" {
+			t.Errorf("wrong message: %q", have)
+		}
+	})
+}
@@ -0,0 +1,219 @@
+package zhttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Environment variables to pass the listeners to the new process on upgrade;
+// this is similar to the systemd socket activation protocol, except that we
+// can't know the PID of the new process in advance, so we pass our own PID
+// and check the parent PID.
+//
+// The first extra file is the write end of a pipe to report readiness, and the
+// listeners follow after that. The names are "http", "redirect", or "http3";
+// "http-unlink" is a unix socket that was created by us rather than passed by
+// systemd, which should be removed on close.
+const (
+	envUpgradePPID = "ZHTTP_UPGRADE_PPID"
+	envUpgradeFds  = "ZHTTP_UPGRADE_FDS"
+	envUpgradeName = "ZHTTP_UPGRADE_FDNAMES"
+)
+
+// Maximum time to wait for the new process to become ready.
+const upgradeTimeout = 60 * time.Second
+
+// inherited are the sockets passed from the parent process during an upgrade.
+type inherited struct {
+	listeners []net.Listener // Main server.
+	owned     net.Listener   // Unix socket in listeners we should remove on close.
+	redirect  net.Listener   // Redirect server, if any.
+	http3     net.PacketConn // HTTP/3 server, if any.
+	ready     *os.File       // Pipe to report readiness on.
+}
+
+// inheritedListeners returns the sockets passed from the parent process during
+// an upgrade.
+//
+// This returns nil if this process wasn't started by an upgrade.
+func inheritedListeners() (*inherited, error) {
+	ppid, err := strconv.Atoi(os.Getenv(envUpgradePPID))
+	if err != nil || ppid != os.Getppid() {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv(envUpgradeFds))
+	if err != nil || n <= 0 {
+		return nil, nil
+	}
+	names := strings.Split(os.Getenv(envUpgradeName), ":")
+
+	os.Unsetenv(envUpgradePPID)
+	os.Unsetenv(envUpgradeFds)
+	os.Unsetenv(envUpgradeName)
+
+	inh := &inherited{
+		ready:     os.NewFile(uintptr(listenFdsStart), "upgrade-ready"),
+		listeners: make([]net.Listener, 0, n),
+	}
+	for i := range n {
+		var (
+			fd   = listenFdsStart + 1 + i
+			f    = os.NewFile(uintptr(fd), "upgrade-fd-"+strconv.Itoa(fd))
+			name string
+		)
+		if i < len(names) {
+			name = names[i]
+		}
+
+		if name == "http3" {
+			pc, err := net.FilePacketConn(f)
+			f.Close()
+			if err != nil {
+				inh.close()
+				return nil, fmt.Errorf("zhttp: inherit packet conn fd %d: %w", fd, err)
+			}
+			inh.http3 = pc
+			continue
+		}
+
+		ln, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			inh.close()
+			return nil, fmt.Errorf("zhttp: inherit listener fd %d: %w", fd, err)
+		}
+		// The parent doesn't remove unix sockets it created after handing them
+		// over, so we're responsible for it now.
+		if ul, ok := ln.(*net.UnixListener); ok && name == "http-unlink" {
+			ul.SetUnlinkOnClose(true)
+			inh.owned = ln
+		}
+		if name == "redirect" {
+			inh.redirect = ln
+		} else {
+			inh.listeners = append(inh.listeners, ln)
+		}
+	}
+	return inh, nil
+}
+
+func (inh *inherited) close() {
+	for _, l := range inh.listeners {
+		l.Close()
+	}
+	if inh.redirect != nil {
+		inh.redirect.Close()
+	}
+	if inh.http3 != nil {
+		inh.http3.Close()
+	}
+	if inh.ready != nil {
+		inh.ready.Close()
+	}
+}
+
+// upgrade starts a new process of the binary, handing over the listeners. This
+// returns once the new process reports it's ready to accept connections.
+//
+// The new process is killed if the context is cancelled before that.
+func (s *Server) upgrade(ctx context.Context) error {
+	// The new process would use Server.Listeners rather than the listeners we
+	// hand over, and we don't know how to recreate them.
+	if len(s.Listeners) > 0 {
+		return errors.New("can't upgrade with Server.Listeners")
+	}
+
+	var (
+		files []*os.File
+		names []string
+	)
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	add := func(ln any, name string) error {
+		fl, ok := ln.(interface{ File() (*os.File, error) })
+		if !ok {
+			return fmt.Errorf("can't get file for %T", ln)
+		}
+		f, err := fl.File()
+		if err != nil {
+			return err
+		}
+		files, names = append(files, f), append(names, name)
+		return nil
+	}
+	for _, ln := range s.listeners {
+		name := "http"
+		if ln == s.ownedSocket {
+			name = "http-unlink"
+		}
+		if err := add(ln, name); err != nil {
+			return err
+		}
+	}
+	if s.redirectLn != nil {
+		if err := add(s.redirectLn, "redirect"); err != nil {
+			return err
+		}
+	}
+	if s.http3Conn != nil {
+		if err := add(s.http3Conn, "http3"); err != nil {
+			return err
+		}
+	}
+
+	rd, wr, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer rd.Close()
+
+	cmd := exec.Command(s.argv0, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.ExtraFiles = append([]*os.File{wr}, files...)
+	cmd.Env = append(os.Environ(),
+		envUpgradePPID+"="+strconv.Itoa(os.Getpid()),
+		envUpgradeFds+"="+strconv.Itoa(len(files)),
+		envUpgradeName+"="+strings.Join(names, ":"))
+	err = cmd.Start()
+	wr.Close()
+	setNonblock(files)
+	if err != nil {
+		return err
+	}
+
+	// The new process writes a byte once it's ready; it exited or failed if
+	// the pipe is closed before that.
+	rd.SetReadDeadline(time.Now().Add(upgradeTimeout))
+	stop := context.AfterFunc(ctx, func() { rd.SetReadDeadline(time.Now()) })
+	defer stop()
+	_, err = rd.Read(make([]byte, 1))
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		if ctx.Err() != nil {
+			return fmt.Errorf("cancelled waiting for new process: %w", ctx.Err())
+		}
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return errors.New("timeout waiting for new process to become ready")
+		}
+		return errors.New("new process exited before it was ready")
+	}
+
+	// The new process owns the sockets now; don't remove them on close.
+	for _, ln := range s.listeners {
+		if ul, ok := ln.(*net.UnixListener); ok {
+			ul.SetUnlinkOnClose(false)
+		}
+	}
+	return cmd.Process.Release()
+}
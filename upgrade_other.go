@@ -0,0 +1,7 @@
+//go:build !unix
+
+package zhttp
+
+import "os"
+
+func setNonblock([]*os.File) {}
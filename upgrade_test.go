@@ -0,0 +1,209 @@
+//go:build unix
+
+package zhttp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestUpgrade(t *testing.T) {
+	if os.Getenv(envUpgradePPID) != "" {
+		upgradeChild(nil)
+		return
+	}
+
+	// The new process is started with the same arguments; make sure it only
+	// runs this test.
+	args := os.Args
+	os.Args = []string{os.Args[0], "-test.run=^TestUpgrade$"}
+	defer func() { os.Args = args }()
+
+	ready := make(chan struct{})
+	s := Server{
+		Server: &http.Server{Addr: "127.0.0.1:0", Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("old"))
+		})},
+		Signals: map[os.Signal]SignalAction{syscall.SIGUSR2: SignalUpgrade},
+		Logger:  slog.New(slog.DiscardHandler),
+		Ready:   func() { close(ready) },
+	}
+
+	errCh := make(chan error)
+	go func() { errCh <- s.Run(context.Background()) }()
+	<-ready
+
+	syscall.Kill(os.Getpid(), syscall.SIGUSR2)
+	select {
+	case err := <-errCh:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("timeout")
+	}
+
+	resp, err := http.Get("http://" + s.Server.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(b) != "new" {
+		t.Errorf("wrong body: %q", b)
+	}
+}
+
+// The new process should report it's ready if it uses Server.Listeners instead
+// of the inherited sockets.
+func TestUpgradeListeners(t *testing.T) {
+	if os.Getenv(envUpgradePPID) != "" {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			panic(err)
+		}
+		upgradeChild([]net.Listener{ln})
+		return
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	f, err := ln.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rd, wr, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rd.Close()
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestUpgradeListeners$")
+	cmd.ExtraFiles = []*os.File{wr, f}
+	cmd.Env = append(os.Environ(),
+		envUpgradePPID+"="+strconv.Itoa(os.Getpid()),
+		envUpgradeFds+"=1",
+		envUpgradeName+"=http")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	wr.Close()
+	defer cmd.Wait()
+
+	rd.SetReadDeadline(time.Now().Add(10 * time.Second))
+	if _, err := rd.Read(make([]byte, 1)); err != nil {
+		cmd.Process.Kill()
+		t.Fatalf("new process didn't report ready: %v", err)
+	}
+	cmd.Process.Signal(syscall.SIGTERM)
+
+	s := Server{Listeners: []net.Listener{ln}}
+	if err := s.upgrade(context.Background()); err == nil {
+		t.Error("no error from upgrade() with Listeners")
+	}
+}
+
+// Only unix sockets we created should be removed by the new process, and not
+// sockets from systemd.
+func TestUpgradeUnlink(t *testing.T) {
+	if os.Getenv(envUpgradePPID) != "" {
+		upgradeChild(nil)
+		return
+	}
+
+	for _, name := range []string{"http", "http-unlink"} {
+		t.Run(name, func(t *testing.T) {
+			sock := filepath.Join(t.TempDir(), "zhttp.sock")
+			ln, err := net.Listen("unix", sock)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ln.(*net.UnixListener).SetUnlinkOnClose(false)
+			defer ln.Close()
+			f, err := ln.(*net.UnixListener).File()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			rd, wr, err := os.Pipe()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rd.Close()
+
+			cmd := exec.Command(os.Args[0], "-test.run=^TestUpgradeUnlink$")
+			cmd.ExtraFiles = []*os.File{wr, f}
+			cmd.Env = append(os.Environ(),
+				envUpgradePPID+"="+strconv.Itoa(os.Getpid()),
+				envUpgradeFds+"=1",
+				envUpgradeName+"="+name)
+			if err := cmd.Start(); err != nil {
+				t.Fatal(err)
+			}
+			wr.Close()
+			rd.SetReadDeadline(time.Now().Add(10 * time.Second))
+			if _, err := rd.Read(make([]byte, 1)); err != nil {
+				cmd.Process.Kill()
+				t.Fatalf("new process didn't report ready: %v", err)
+			}
+
+			client := &http.Client{Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return (&net.Dialer{}).DialContext(ctx, "unix", sock)
+				},
+			}}
+			resp, err := client.Get("http://unix/")
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if err := cmd.Wait(); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = os.Stat(sock)
+			if name == "http" && err != nil {
+				t.Errorf("socket removed: %s", err)
+			}
+			if name == "http-unlink" && !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("socket not removed: %v", err)
+			}
+		})
+	}
+}
+
+// Serve one request on the inherited socket, and exit.
+func upgradeChild(listeners []net.Listener) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	s := Server{
+		Server: &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Connection", "close")
+			w.Write([]byte("new"))
+			cancel()
+		})},
+		Listeners: listeners,
+		Logger:    slog.New(slog.DiscardHandler),
+	}
+	err := s.Run(ctx)
+	if err != nil {
+		panic(err)
+	}
+	os.Exit(0)
+}
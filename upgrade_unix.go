@@ -0,0 +1,17 @@
+//go:build unix
+
+package zhttp
+
+import (
+	"os"
+	"syscall"
+)
+
+// Passing the files to a new process with exec.Cmd.ExtraFiles puts them in
+// blocking mode, and the file descriptors share this with our listeners. Accept
+// on a blocking listener doesn't return on Close(), so set it back.
+func setNonblock(files []*os.File) {
+	for _, f := range files {
+		syscall.SetNonblock(int(f.Fd()), true)
+	}
+}
@@ -0,0 +1,83 @@
+package zhttp
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"zgo.at/json"
+)
+
+// ValidationErrors are validation errors for one or more fields.
+//
+// [UserError] uses Status as the status code, and [DefaultErrPage] renders it
+// as:
+//
+//   - JSON: {"errors": {"email": ["must be set"]}}
+//   - problem+json: an "errors" extension member with the same object.
+//   - Forms: the errors and submitted values are added with [FlashFormErrors], in
+//     addition to a regular flash message. Use [ReadFlashForm] to display
+//     them next to the fields.
+//   - Other formats use Error(): "email: must be set; name: too long".
+type ValidationErrors struct {
+	Errors map[string][]string // Messages by field name.
+	Status int                 // HTTP status code; 400 if 0. 422 is also common.
+}
+
+// Append a message for the field.
+func (v *ValidationErrors) Append(field, msg string) {
+	if v.Errors == nil {
+		v.Errors = make(map[string][]string)
+	}
+	v.Errors[field] = append(v.Errors[field], msg)
+}
+
+// HasErrors reports if there are any errors.
+func (v *ValidationErrors) HasErrors() bool { return len(v.Errors) > 0 }
+
+// ErrorOrNil returns nil if there are no errors, or v if there are.
+func (v *ValidationErrors) ErrorOrNil() error {
+	if !v.HasErrors() {
+		return nil
+	}
+	return v
+}
+
+// Code gets the HTTP status code.
+func (v *ValidationErrors) Code() int {
+	if v.Status == 0 {
+		return http.StatusBadRequest
+	}
+	return v.Status
+}
+
+func (v *ValidationErrors) Error() string {
+	fields := make([]string, 0, len(v.Errors))
+	for f := range v.Errors {
+		fields = append(fields, f)
+	}
+	slices.Sort(fields)
+
+	var b strings.Builder
+	for i, f := range fields {
+		if i > 0 {
+			b.WriteString("; ")
+		}
+		b.WriteString(f)
+		b.WriteString(": ")
+		b.WriteString(strings.Join(v.Errors[f], ", "))
+	}
+	return b.String()
+}
+
+// MarshalJSON writes {"errors": {"field": ["msg", ..]}}.
+func (v *ValidationErrors) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]any{"errors": v.errors()})
+}
+
+func (v *ValidationErrors) errors() map[string][]string {
+	if v.Errors == nil {
+		return map[string][]string{}
+	}
+	return v.Errors
+}
@@ -0,0 +1,100 @@
+package zhttp
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"zgo.at/zstd/ztest"
+)
+
+func TestValidationErrors(t *testing.T) {
+	var v ValidationErrors
+	if v.ErrorOrNil() != nil {
+		t.Fatal("ErrorOrNil not nil")
+	}
+	v.Append("email", "must be set")
+	v.Append("name", "too long")
+	v.Append("name", "contains invalid characters")
+
+	tests := []struct {
+		accept   string
+		status   int
+		wantCode int
+		wantBody string
+	}{
+		{"application/json", 0, 400,
+			`{"errors":{"email":["must be set"],"name":["too long","contains invalid characters"]}}`},
+		{"application/json", 422, 422,
+			`{"errors":{"email":["must be set"],"name":["too long","contains invalid characters"]}}`},
+		{"application/problem+json", 0, 400,
+			`{"detail":"validation failed","errors":{"email":["must be set"],"name":["too long","contains invalid characters"]},"status":400,"title":"Bad Request"}`},
+		{"text/plain", 0, 400,
+			`Error 400: email: must be set; name: too long, contains invalid characters`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			v.Status = tt.status
+			rr := httptest.NewRecorder()
+			r := httptest.NewRequest("GET", "/", nil)
+			r.Header.Set("Accept", tt.accept)
+			DefaultErrPage(rr, r, v.ErrorOrNil())
+
+			ztest.Code(t, rr, tt.wantCode)
+			if have := strings.TrimSpace(rr.Body.String()); have != tt.wantBody {
+				t.Errorf("\nhave: %s\nwant: %s", have, tt.wantBody)
+			}
+		})
+	}
+
+	t.Run("form", func(t *testing.T) {
+		v.Status = 0
+		form := url.Values{"email": {""}, "name": {"Martin"}, "password": {"hunter2"}, "csrf": {"x"}}
+		r := httptest.NewRequest("POST", "/signup", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set("Referer", "/signup")
+		rr := httptest.NewRecorder()
+		DefaultErrPage(rr, r, &v)
+		ztest.Code(t, rr, 303)
+
+		// Follow the redirect with the cookies.
+		r = httptest.NewRequest("GET", "/signup", nil)
+		for _, c := range rr.Result().Cookies() {
+			r.AddCookie(c)
+		}
+		rr = httptest.NewRecorder()
+
+		if f := ReadFlash(rr, r); f == nil || f.Level != LevelError || f.Message != v.Error() {
+			t.Errorf("wrong flash: %#v", f)
+		}
+		f := ReadFlashForm(rr, r)
+		if f == nil {
+			t.Fatal("ReadFlashForm returned nil")
+		}
+		if have := f.Error("name"); have != "too long" {
+			t.Errorf("wrong error: %q", have)
+		}
+		if have := f.Value("name"); have != "Martin" {
+			t.Errorf("wrong value: %q", have)
+		}
+		if f.Values.Has("password") || f.Values.Has("csrf") {
+			t.Errorf("stored password or csrf: %v", f.Values)
+		}
+
+		var cleared bool
+		for _, c := range rr.Result().Cookies() {
+			if c.Name == cookieFlashForm && c.Value == "" {
+				cleared = true
+			}
+		}
+		if !cleared {
+			t.Error("flash_form cookie not cleared")
+		}
+
+		var nilForm *FlashForm
+		if nilForm.Error("x") != "" || nilForm.Value("x") != "" {
+			t.Error("nil FlashForm")
+		}
+	})
+}
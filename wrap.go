@@ -2,17 +2,19 @@ package zhttp
 
 import (
 	"context"
-	"database/sql"
 	"errors"
 	"fmt"
 	"hash/fnv"
 	"io"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"zgo.at/json"
+	"zgo.at/zhttp/header"
 	"zgo.at/ztpl"
 )
 
@@ -33,42 +35,29 @@ func CookiePath() string {
 // UserError modifies an error for user display.
 //
 //   - Removes any stack traces from zgo.at/errors or github.com/pkg/errors.
-//   - Reformats some messages to be more user-friendly.
+//   - Sets the status code and reformats some messages to be more
+//     user-friendly; see [RegisterErrorClassifier].
 //   - "Hides" messages behind an error code for 5xx errors (you need to log those yourself).
+//
+// Use [UserErrorContext] to translate the messages.
 func UserError(err error) (int, error) {
+	return UserErrorContext(context.Background(), err)
+}
+
+// UserErrorContext is like [UserError], but translates the built-in messages
+// with [T].
+func UserErrorContext(ctx context.Context, err error) (int, error) {
 	if _, ok := err.(interface{ StackTrace() string }); ok {
 		err = errors.Unwrap(err)
 	}
 
-	var (
-		stErr interface {
-			Code() int
-			Error() string
-		}
-		pqErr interface {
-			SQLState() string
-			Error() string
-		}
-		dErr *ErrorDecode
-		uErr *ErrorDecodeUnknown
-		code = 500
-	)
-	switch {
-	case errors.As(err, &stErr): // zgo.at/guru with an embedded status code.
-		code, err = stErr.Code(), stErr
-	case errors.As(err, &pqErr): // PostgreSQL
-		switch pqErr.SQLState() {
-		case "22021": //  pq: invalid byte sequence for encoding "UTF8": 0xd5
-			code, err = 400, pqErr
+	code, err := classifyError(err)
+
+	tr := func(e error) error {
+		if t, ok := e.(translatable); ok && GetLanguage(ctx) != "" {
+			return &translatedErr{e, t.translate(ctx)}
 		}
-	case errors.As(err, &dErr): // Invalid parameters.
-		code = 400
-	case errors.As(err, &uErr): // Invalid parameters.
-		code = 400
-	case errors.Is(err, sql.ErrNoRows):
-		code = 404
-	case errors.Is(err, context.DeadlineExceeded):
-		code = http.StatusGatewayTimeout
+		return e
 	}
 
 	switch {
@@ -77,15 +66,15 @@ func UserError(err error) (int, error) {
 	// appears the same as an object the user has no permissions to access,
 	// which makes enumeration attacks harder.
 	case code == 404:
-		return code, errors.New("not found")
+		return code, userProblem(err, code, tr(newUserMsg("not found")))
 	case code == http.StatusGatewayTimeout:
-		return code, errors.New("server timed out loading data")
+		return code, userProblem(err, code, tr(newUserMsg("server timed out loading data")))
 	case code >= 500:
-		return code, fmt.Errorf(
-			`unexpected error code ‘%s’; this has been reported for investigation`,
-			UserErrorCode(err))
+		return code, userProblem(err, code, tr(newUserMsg(
+			"unexpected error code ‘%s’; this has been reported for investigation",
+			UserErrorCode(err))))
 	default:
-		return code, err
+		return code, tr(err)
 	}
 }
 
@@ -112,20 +101,34 @@ var ErrPage = DefaultErrPage
 // DefaultErrPage is the default error page.
 //
 // Any unknown errors are displayed as an error code, with the real error being
-// logged. This ensures people don't see entire stack traces or whatnot, which
-// isn't too useful.
+// logged and sent to [ErrReporter]. This ensures people don't see entire stack
+// traces or whatnot, which isn't too useful.
+//
+// The format is chosen in this order:
+//
+//   - The Content-Type of the response, if it's already set.
+//   - Forms add the error as a flash message and redirect back to the previous
+//     page (via the Referer header), unless the Accept header explicitly asks
+//     for a format other than HTML. [ValidationErrors] are also added with
+//     [FlashFormErrors].
+//   - The Accept header, ignoring "*/*".
+//   - The Content-Type of the request.
+//   - The Accept header with "*/*", which is the first registered format.
+//
+// The default formats are:
+//
+// text/html tries to render error.gohtml with ztpl if it's loaded, or writes a
+// simple default HTML document instead. The Code and Error parameters are set
+// for the HTML template.
 //
-// The data written depends on the content type:
+// application/json writes {"error" "the error message"}, or the output of
+// MarshalJSON() or ErrorJSON() if the error has that method.
 //
-// Regular HTML GET requests try to render error.gohtml with ztpl if it's
-// loaded, or writes a simple default HTML document instead. The Code and Error
-// parameters are set for the HTML template.
+// text/plain writes "Error [code]: [message]".
 //
-// JSON requests write {"error" "the error message"}
+// application/problem+json writes RFC 9457 problem details; see [Problem].
 //
-// Forms add the error as a flash message and redirect back to the previous page
-// (via the Referer header), or render the error.gohtml template if the header
-// isn't set.
+// Use [RegisterErrPage] to add more formats.
 func DefaultErrPage(w http.ResponseWriter, r *http.Request, reported error) {
 	if reported == nil {
 		return
@@ -135,75 +138,196 @@ func DefaultErrPage(w http.ResponseWriter, r *http.Request, reported error) {
 		hasStatus = false
 	}
 
-	code, userErr := UserError(reported)
+	code, userErr := UserErrorContext(r.Context(), reported)
 	if code >= 500 {
-		attr := []any{"code", UserErrorCode(reported)}
-
+		var (
+			errCode = UserErrorCode(reported)
+			attr    = []any{"code", errCode}
+			stack   string
+		)
 		sErr := new(interface{ StackTrace() string })
 		if errors.As(reported, sErr) {
 			reported = errors.Unwrap(reported)
-			attr = append(attr, "stacktrace", "\n"+(*sErr).StackTrace())
+			stack = (*sErr).StackTrace()
+			attr = append(attr, "stacktrace", "\n"+stack)
 		}
 		withRequest(r).Error(reported.Error(), attr...)
+
+		if ErrReporter != nil {
+			ErrReporter.ReportError(ErrorReport{
+				Err:     reported,
+				Code:    errCode,
+				Status:  code,
+				Stack:   stack,
+				Request: r,
+				Count:   1,
+			})
+		}
 	}
 
-	ct := strings.ToLower(r.Header.Get("Content-Type"))
-	ctresp := strings.ToLower(w.Header().Get("Content-Type"))
-	switch {
-	case strings.HasPrefix(ct, "application/json") || strings.HasPrefix(ctresp, "application/json"):
-		if !hasStatus {
-			w.WriteHeader(code)
+	f := errPageNegotiate(w, r, hasStatus)
+	if ProblemJSON && f != nil && f.mediaType == "application/json" {
+		f = findErrPageFormat("application/problem+json")
+	}
+	if f == nil {
+		flash(w, r, LevelError, userErr.Error()) // Already translated.
+		var vErr *ValidationErrors
+		if errors.As(userErr, &vErr) {
+			if r.PostForm == nil {
+				_ = r.ParseForm()
+			}
+			FlashFormErrors(w, r, vErr, r.PostForm)
 		}
+		SeeOther(w, r.Referer())
+		return
+	}
+	if !hasStatus {
+		if mediaType(w.Header().Get("Content-Type")) != f.mediaType {
+			ct := f.mediaType
+			if strings.HasPrefix(ct, "text/") {
+				ct += "; charset=utf-8"
+			}
+			w.Header().Set("Content-Type", ct)
+		}
+		w.WriteHeader(code)
+	}
+	f.render(w, r, code, userErr)
+}
 
-		var (
-			j   []byte
-			err error
-		)
+// ErrPageRenderer writes an error for [DefaultErrPage].
+//
+// The code is the HTTP status code and err is the error from [UserError]. The
+// status code and Content-Type header are already written.
+type ErrPageRenderer func(w http.ResponseWriter, r *http.Request, code int, err error)
+
+type errPageFormat struct {
+	mediaType string
+	render    ErrPageRenderer
+}
 
-		if jErr, ok := userErr.(json.Marshaler); ok {
-			j, err = jErr.MarshalJSON()
-		} else if jErr, ok := userErr.(interface{ ErrorJSON() ([]byte, error) }); ok {
-			j, err = jErr.ErrorJSON()
-		} else {
-			j, err = json.Marshal(map[string]string{"error": userErr.Error()})
+var errPageFormats = []errPageFormat{
+	{"text/html", errPageHTML},
+	{"application/json", errPageJSON},
+	{"text/plain", errPageText},
+	{"application/problem+json", errPageProblem},
+}
+
+// RegisterErrPage registers a format for [DefaultErrPage], replacing the
+// existing renderer if the media type is already registered. New formats are
+// added at the end, so they're only used if the client explicitly asks for it.
+//
+// This is not safe for concurrent use, and should be called on startup.
+func RegisterErrPage(mediaType string, render ErrPageRenderer) {
+	mediaType = strings.ToLower(mediaType)
+	for i := range errPageFormats {
+		if errPageFormats[i].mediaType == mediaType {
+			errPageFormats[i].render = render
+			return
 		}
-		if err != nil {
-			withRequest(r).Error(err.Error())
+	}
+	errPageFormats = append(errPageFormats, errPageFormat{mediaType, render})
+}
+
+func findErrPageFormat(mediaType string) *errPageFormat {
+	for i := range errPageFormats {
+		if errPageFormats[i].mediaType == mediaType {
+			return &errPageFormats[i]
 		}
-		w.Write(j)
+	}
+	return nil
+}
+
+// errPageNegotiate gets the format to use, or nil if this is a form that
+// should be redirected.
+func errPageNegotiate(w http.ResponseWriter, r *http.Request, hasStatus bool) *errPageFormat {
+	var (
+		ct     = mediaType(r.Header.Get("Content-Type"))
+		ctresp = mediaType(w.Header().Get("Content-Type"))
+	)
+	if f := findErrPageFormat(ctresp); f != nil {
+		return f
+	}
 
-	case strings.HasPrefix(ct, "text/plain") || strings.HasPrefix(ctresp, "text/plain"):
-		if !hasStatus {
-			w.WriteHeader(code)
+	offers := make([]string, 0, len(errPageFormats))
+	for _, f := range errPageFormats {
+		offers = append(offers, f.mediaType)
+	}
+	var (
+		accept   = header.ParseAccept(r.Header, "Accept")
+		explicit = make([]header.AcceptSpec, 0, len(accept))
+		f        *errPageFormat
+	)
+	for _, a := range accept {
+		if a.Value != "*/*" {
+			explicit = append(explicit, a)
 		}
-		fmt.Fprintf(w, "Error %d: %s", code, userErr)
+	}
+	if len(explicit) > 0 {
+		f = findErrPageFormat(header.Negotiate(explicit, offers...))
+	}
 
-	case (!hasStatus && r.Referer() != "" &&
+	isForm := (!hasStatus && r.Referer() != "" &&
 		(ct == "application/x-www-form-urlencoded" || ctresp == "application/x-www-form-urlencoded")) ||
-		(strings.HasPrefix(ct, "multipart/") || strings.HasPrefix(ctresp, "multipart/")):
-		FlashError(w, r, userErr.Error())
-		SeeOther(w, r.Referer())
+		(strings.HasPrefix(ct, "multipart/") || strings.HasPrefix(ctresp, "multipart/"))
+	if isForm && (f == nil || f.mediaType == "text/html") {
+		return nil
+	}
+	if f != nil {
+		return f
+	}
+	if f := findErrPageFormat(ct); f != nil {
+		return f
+	}
+	if f := findErrPageFormat(header.Negotiate(accept, offers...)); f != nil {
+		return f
+	}
+	return &errPageFormats[0]
+}
 
-	default:
-		if !hasStatus {
-			w.WriteHeader(code)
-		}
+// mediaType gets the lower-cased media type from a Content-Type header,
+// without parameters.
+func mediaType(ct string) string {
+	ct, _, _ = strings.Cut(ct, ";")
+	return strings.ToLower(strings.TrimSpace(ct))
+}
 
-		if !ztpl.HasTemplate("error.gohtml") {
-			fmt.Fprintf(w, "<pre>Error %d: %s</pre>", code, userErr)
-			return
-		}
+func errPageHTML(w http.ResponseWriter, r *http.Request, code int, userErr error) {
+	if !ztpl.HasTemplate("error.gohtml") {
+		fmt.Fprintf(w, "<pre>Error %d: %s</pre>", code, userErr)
+		return
+	}
 
-		err := ztpl.Execute(w, "error.gohtml", struct {
-			Code  int
-			Error error
-			Base  string
-			Path  string
-		}{code, userErr, BasePath, r.URL.Path})
-		if err != nil {
-			withRequest(r).Error(err.Error())
-		}
+	err := ztpl.Execute(w, "error.gohtml", struct {
+		Code  int
+		Error error
+		Base  string
+		Path  string
+	}{code, userErr, BasePath, r.URL.Path})
+	if err != nil {
+		withRequest(r).Error(err.Error())
+	}
+}
+
+func errPageJSON(w http.ResponseWriter, r *http.Request, code int, userErr error) {
+	var (
+		j   []byte
+		err error
+	)
+	if jErr, ok := userErr.(json.Marshaler); ok {
+		j, err = jErr.MarshalJSON()
+	} else if jErr, ok := userErr.(interface{ ErrorJSON() ([]byte, error) }); ok {
+		j, err = jErr.ErrorJSON()
+	} else {
+		j, err = json.Marshal(map[string]string{"error": userErr.Error()})
+	}
+	if err != nil {
+		withRequest(r).Error(err.Error())
 	}
+	w.Write(j)
+}
+
+func errPageText(w http.ResponseWriter, r *http.Request, code int, userErr error) {
+	fmt.Fprintf(w, "Error %d: %s", code, userErr)
 }
 
 type HandlerFunc func(http.ResponseWriter, *http.Request) error
@@ -244,6 +368,48 @@ func Stream(w http.ResponseWriter, fp io.Reader) error {
 	return err
 }
 
+// FileContent is like [File], but supports Range and conditional requests; see
+// [StreamContent]. The file's modification time is used for Last-Modified.
+//
+// This does NO PATH NORMALISATION! People can enter "../../../../etc/passwd".
+// Make sure you sanitize your paths if they're from untrusted input.
+func FileContent(w http.ResponseWriter, r *http.Request, path, etag string) error {
+	fp, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+	st, err := fp.Stat()
+	if err != nil {
+		return err
+	}
+	if st.IsDir() {
+		return fmt.Errorf("zhttp.FileContent: %q is a directory", path)
+	}
+	return StreamContent(w, r, filepath.Base(path), st.ModTime(), etag, fp)
+}
+
+// StreamContent is like [Stream], but supports Range requests (including
+// multipart ranges), conditional requests with If-Match, If-None-Match,
+// If-Modified-Since, etc., and HEAD requests. It sends 206, 304, 412, or 416
+// responses as needed, and always sets Content-Length.
+//
+// The modtime and etag are both optional; the etag is quoted if it's not
+// already. The Content-Type is set from the extension in name, or by sniffing
+// the content, unless it's already set.
+//
+// This uses [http.ServeContent].
+func StreamContent(w http.ResponseWriter, r *http.Request, name string, modtime time.Time, etag string, fp io.ReadSeeker) error {
+	if etag != "" {
+		if !strings.HasPrefix(etag, `"`) && !strings.HasPrefix(etag, `W/"`) {
+			etag = `"` + etag + `"`
+		}
+		w.Header().Set("Etag", etag)
+	}
+	http.ServeContent(w, r, name, modtime, fp)
+	return nil
+}
+
 // NoContent writes the NoContent status code (204).
 func NoContent(w http.ResponseWriter) error {
 	writeStatus(w, http.StatusNoContent, "")
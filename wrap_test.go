@@ -2,12 +2,21 @@ package zhttp
 
 import (
 	"errors"
+	"fmt"
+	"io"
 	"log/slog"
+	"mime"
+	"mime/multipart"
+	"net/http"
 	"net/http/httptest"
 	"os"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"zgo.at/guru"
+	"zgo.at/zstd/ztest"
 	"zgo.at/ztpl"
 )
 
@@ -92,3 +101,179 @@ func TestErrPage(t *testing.T) {
 		})
 	}
 }
+
+func TestErrPageNegotiate(t *testing.T) {
+	defer func(f []errPageFormat) { errPageFormats = f }(slices.Clone(errPageFormats))
+	RegisterErrPage("application/xml", func(w http.ResponseWriter, r *http.Request, code int, err error) {
+		fmt.Fprintf(w, "<error>%s</error>", err)
+	})
+
+	tests := []struct {
+		name, ct, ctresp, accept, referer string
+		wantCT                            string
+	}{
+		{"default", "", "", "", "", "text/html; charset=utf-8"},
+		{"browser", "", "", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", "", "text/html; charset=utf-8"},
+		{"fetch", "", "", "application/json", "", "application/json"},
+		{"q-values", "", "", "text/html;q=0.5, application/json", "", "application/json"},
+		{"registered", "", "", "application/xml", "", "application/xml"},
+		{"request ct", "application/json", "", "*/*", "", "application/json"},
+		{"accept over request ct", "application/json", "", "text/plain", "", "text/plain; charset=utf-8"},
+		{"response ct", "", "application/json", "text/html", "", "application/json"},
+		{"unknown", "", "", "image/png", "", "text/html; charset=utf-8"},
+		{"form", "application/x-www-form-urlencoded", "", "text/html", "/prev", ""},
+		{"form with json", "application/x-www-form-urlencoded", "", "application/json", "/prev", "application/json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			r := httptest.NewRequest("GET", "/", nil)
+			if tt.ct != "" {
+				r.Header.Set("Content-Type", tt.ct)
+			}
+			if tt.ctresp != "" {
+				rr.Header().Set("Content-Type", tt.ctresp)
+			}
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+			if tt.referer != "" {
+				r.Header.Set("Referer", tt.referer)
+			}
+
+			DefaultErrPage(rr, r, guru.New(400, "oh noes"))
+			if tt.wantCT == "" {
+				ztest.Code(t, rr, 303)
+				if l := rr.Header().Get("Location"); l != tt.referer {
+					t.Errorf("wrong Location: %q", l)
+				}
+				return
+			}
+			ztest.Code(t, rr, 400)
+			if have := rr.Header().Get("Content-Type"); have != tt.wantCT {
+				t.Errorf("\nhave: %q\nwant: %q\nbody: %s", have, tt.wantCT, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestStreamContent(t *testing.T) {
+	var (
+		modtime = time.Date(2020, 6, 18, 14, 0, 0, 0, time.UTC)
+		content = "0123456789"
+	)
+	tests := []struct {
+		method   string
+		header   map[string]string
+		wantCode int
+		wantBody string
+		wantHdr  map[string]string
+	}{
+		{"GET", nil, 200, content, map[string]string{
+			"Content-Length": "10",
+			"Etag":           `"abc"`,
+			"Last-Modified":  "Thu, 18 Jun 2020 14:00:00 GMT",
+			"Accept-Ranges":  "bytes",
+			"Content-Type":   "text/plain; charset=utf-8",
+		}},
+		{"HEAD", nil, 200, "", map[string]string{"Content-Length": "10"}},
+		{"GET", map[string]string{"Range": "bytes=2-4"}, 206, "234", map[string]string{
+			"Content-Range":  "bytes 2-4/10",
+			"Content-Length": "3",
+		}},
+		{"GET", map[string]string{"Range": "bytes=-2"}, 206, "89", nil},
+		{"GET", map[string]string{"Range": "bytes=20-"}, 416, "", map[string]string{
+			"Content-Range": "bytes */10",
+		}},
+		{"GET", map[string]string{"If-None-Match": `"abc"`}, 304, "", nil},
+		{"GET", map[string]string{"If-None-Match": `"xyz"`}, 200, content, nil},
+		{"GET", map[string]string{"If-Modified-Since": "Thu, 18 Jun 2020 14:00:00 GMT"}, 304, "", nil},
+		{"GET", map[string]string{"If-Match": `"xyz"`}, 412, "", nil},
+		{"GET", map[string]string{"Range": "bytes=0-1", "If-Range": `"xyz"`}, 200, content, nil},
+		{"GET", map[string]string{"Range": "bytes=0-1", "If-Range": `"abc"`}, 206, "01", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run("", func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/", nil)
+			for k, v := range tt.header {
+				r.Header.Set(k, v)
+			}
+			rr := httptest.NewRecorder()
+			err := StreamContent(rr, r, "file.txt", modtime, "abc", strings.NewReader(content))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ztest.Code(t, rr, tt.wantCode)
+			if tt.wantCode != 416 && tt.wantCode != 412 {
+				if have := rr.Body.String(); have != tt.wantBody {
+					t.Errorf("\nhave: %q\nwant: %q", have, tt.wantBody)
+				}
+			}
+			for k, want := range tt.wantHdr {
+				if have := rr.Header().Get(k); have != want {
+					t.Errorf("header %q\nhave: %q\nwant: %q", k, have, want)
+				}
+			}
+		})
+	}
+
+	t.Run("multipart", func(t *testing.T) {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Range", "bytes=0-1,5-6")
+		rr := httptest.NewRecorder()
+		StreamContent(rr, r, "file.txt", modtime, "", strings.NewReader(content))
+
+		ztest.Code(t, rr, 206)
+		mt, params, err := mime.ParseMediaType(rr.Header().Get("Content-Type"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mt != "multipart/byteranges" {
+			t.Fatalf("wrong Content-Type: %q", mt)
+		}
+		var parts []string
+		mr := multipart.NewReader(rr.Body, params["boundary"])
+		for {
+			p, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, _ := io.ReadAll(p)
+			parts = append(parts, p.Header.Get("Content-Range")+" "+string(b))
+		}
+		if want := []string{"bytes 0-1/10 01", "bytes 5-6/10 56"}; !slices.Equal(parts, want) {
+			t.Errorf("\nhave: %q\nwant: %q", parts, want)
+		}
+	})
+}
+
+func TestFileContent(t *testing.T) {
+	tmp := t.TempDir() + "/x.txt"
+	if err := os.WriteFile(tmp, []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Range", "bytes=1-")
+	rr := httptest.NewRecorder()
+	if err := FileContent(rr, r, tmp, ""); err != nil {
+		t.Fatal(err)
+	}
+	ztest.Code(t, rr, 206)
+	if have := rr.Body.String(); have != "ello" {
+		t.Errorf("wrong body: %q", have)
+	}
+	if rr.Header().Get("Last-Modified") == "" {
+		t.Error("Last-Modified not set")
+	}
+
+	if err := FileContent(httptest.NewRecorder(), r, t.TempDir(), ""); err == nil {
+		t.Error("no error for directory")
+	}
+}
@@ -46,7 +46,7 @@ func NewResponseWriter(w http.ResponseWriter, protoMajor int) ResponseWriter {
 
 	bw := basicWriter{ResponseWriter: w}
 
-	if protoMajor == 2 {
+	if protoMajor >= 2 { // HTTP/2 and HTTP/3 can't be hijacked.
 		_, ps := w.(http.Pusher)
 		if fl && ps {
 			return &http2FancyWriter{bw}
@@ -42,3 +42,17 @@ func TestHttp2FancyWriterRemembersWroteHeaderWhenFlushed(t *testing.T) {
 		t.Fatal("want Flush to have set wroteHeader=true")
 	}
 }
+
+func TestNewResponseWriterHTTP3(t *testing.T) {
+	// HTTP/3 ResponseWriters can flush, but not hijack or push.
+	w := struct {
+		http.ResponseWriter
+		http.Flusher
+		http.Hijacker
+		io.ReaderFrom
+	}{ResponseWriter: httptest.NewRecorder()}
+
+	if _, ok := NewResponseWriter(w, 3).(*flushWriter); !ok {
+		t.Errorf("wrong type: %T", NewResponseWriter(w, 3))
+	}
+}